@@ -20,9 +20,13 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog/v2"
 )
 
@@ -42,7 +46,8 @@ type AdvDeploymentUpdateStrategy struct {
 	Meta                map[string]string    `json:"meta,omitempty"`
 	// Priorities are the rules for calculating the priority of updating pods.
 	// Each pod to be updated, will pass through these terms and get a sum of weights.
-	// Also, priorityStrategy can just be allowed to work with Parallel podManagementPolicy.
+	// It sets the pod deletion cost of Deployment pods, so the pods with higher priority are
+	// replaced first when rolling update, StatefulSet pods are updated in ordinal order.
 	// +optional
 	PriorityStrategy      *UpdatePriorityStrategy `json:"priorityStrategy,omitempty"`
 	Paused                bool                    `json:"paused,omitempty"`
@@ -106,6 +111,7 @@ type AdvDeploymentCondition struct {
 
 // AdvDeploymentAggrStatus advdeployment aggrestatus info
 type AdvDeploymentAggrStatus struct {
+	// OwnerResource the objects applied, formatted as <Kind.group>:<namespace>/<name>
 	OwnerResource []string            `json:"ownerResource,omitempty"`
 	Status        AppStatus           `json:"status,omitempty"`
 	Version       string              `json:"version,omitempty"`
@@ -208,6 +214,9 @@ const (
 	// ReplicaFailure is added in a deployment when one of its pods fails to be created
 	// or deleted.
 	DeploymentReplicaFailure AdvDeploymentConditionType = "ReplicaFailure"
+	// ReconcileFailed is true when the desired resources are not able to be built, such as
+	// the values don't meet the chart schema, nothing is applied then.
+	DeploymentReconcileFailed AdvDeploymentConditionType = "ReconcileFailed"
 )
 
 // DeployState deployment state
@@ -222,6 +231,8 @@ const (
 	Unmanaged       DeployState = "Unmanaged"
 )
 
+// +kubebuilder:webhook:path=/mutate-workload-dmall-com-v1beta1-advdeployment,mutating=true,failurePolicy=fail,sideEffects=None,groups=workload.dmall.com,resources=advdeployments,verbs=create;update,versions=v1beta1,name=madvdeployment.workload.dmall.com,admissionReviewVersions=v1
+
 // Default makes AdvDeployment an mutating webhook
 // When delete, if error occurs, finalizer is a good options for us to retry and
 // record the events.
@@ -233,28 +244,72 @@ func (in *AdvDeployment) Default() {
 	klog.V(4).Info("AdvDeployment: ", in.GetName())
 }
 
+// +kubebuilder:webhook:path=/validate-workload-dmall-com-v1beta1-advdeployment,mutating=false,failurePolicy=fail,sideEffects=None,groups=workload.dmall.com,resources=advdeployments,verbs=create;update,versions=v1beta1,name=vadvdeployment.workload.dmall.com,admissionReviewVersions=v1
+
 // ValidateCreate implements webhook.Validator
-// 1. check filed regex
+// 1. supported deployType, chart present for helm, selector and template present for the others
+// 2. podSet name is unique DNS_LABEL, replicas is integer or percentage
+// 3. only one of orderPriority and weightPriority
 func (in *AdvDeployment) ValidateCreate() error {
 	klog.V(4).Info("validate AdvDeployment create: ", in.GetName())
 
-	return nil
+	return in.toInvalidError(in.validate())
 }
 
-// ValidateUpdate validate HelmRequest update request
+// ValidateUpdate validate AdvDeployment update request, only the changed fields are validated, so
+// the objects created before the webhook could still be updated.
 // immutable fields:
-// 1. ...
+// 1. podSet nodeSelectorTerm
 func (in *AdvDeployment) ValidateUpdate(old runtime.Object) error {
-	klog.V(4).Info("validate HelmRequest update: ", in.GetName())
+	klog.V(4).Info("validate AdvDeployment update: ", in.GetName())
 
-	oldHR, ok := old.(*AdvDeployment)
+	oldAdv, ok := old.(*AdvDeployment)
 	if !ok {
-		return fmt.Errorf("expect old object to be a %T instead of %T", oldHR, old)
+		return fmt.Errorf("expect old object to be a %T instead of %T", oldAdv, old)
+	}
+	if !in.DeletionTimestamp.IsZero() {
+		// only remove finalizers when deleting, don't block it
+		return nil
+	}
+
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+	if !equality.Semantic.DeepEqual(in.Spec.PodSpec, oldAdv.Spec.PodSpec) {
+		allErrs = append(allErrs, validatePodSpec(&in.Spec.PodSpec, specPath.Child("podSpec"))...)
+	}
+	if !equality.Semantic.DeepEqual(in.Spec.Topology.PodSets, oldAdv.Spec.Topology.PodSets) {
+		podSetsPath := specPath.Child("topology", "podSets")
+		allErrs = append(allErrs, validatePodSets(in.Spec.Topology.PodSets, podSetsPath)...)
+		allErrs = append(allErrs, validatePodSetsUpdate(in.Spec.Topology.PodSets, oldAdv.Spec.Topology.PodSets, podSetsPath)...)
 	}
+	if !equality.Semantic.DeepEqual(in.Spec.UpdateStrategy.PriorityStrategy, oldAdv.Spec.UpdateStrategy.PriorityStrategy) {
+		allErrs = append(allErrs, validateUpdatePriorityStrategy(in.Spec.UpdateStrategy.PriorityStrategy, specPath.Child("updateStrategy", "priorityStrategy"))...)
+	}
+	return in.toInvalidError(allErrs)
+}
 
+// ValidateDelete implements webhook.Validator, nothing to validate
+func (in *AdvDeployment) ValidateDelete() error {
 	return nil
 }
 
+func (in *AdvDeployment) validate() field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validatePodSpec(&in.Spec.PodSpec, specPath.Child("podSpec"))...)
+	allErrs = append(allErrs, validatePodSets(in.Spec.Topology.PodSets, specPath.Child("topology", "podSets"))...)
+	allErrs = append(allErrs, validateUpdatePriorityStrategy(in.Spec.UpdateStrategy.PriorityStrategy, specPath.Child("updateStrategy", "priorityStrategy"))...)
+	return allErrs
+}
+
+func (in *AdvDeployment) toInvalidError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "AdvDeployment"}, in.Name, allErrs)
+}
+
 func init() {
 	SchemeBuilder.Register(&AdvDeployment{}, &AdvDeploymentList{})
 }
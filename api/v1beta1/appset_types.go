@@ -17,8 +17,18 @@ limitations under the License.
 package v1beta1
 
 import (
+	"context"
+	"fmt"
+
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // +genclient
@@ -73,16 +83,26 @@ type AppSetSpec struct {
 	// Topology describes the pods distribution detail between each of subsets.
 	// +optional
 	ClusterTopology ClusterTopology `json:"clusterTopology,omitempty"`
+
+	// helm values shared by all podSets of all clusters, the cluster rawValues and the podSet
+	// rawValues are deep merged over it in order.
+	// +optional
+	RawValues string `json:"rawValues,omitempty"`
 }
 
 type AppSetUpdateStrategy struct {
 	// canary, blue, green
-	UpgradeType           string                  `json:"upgradeType,omitempty"`
-	MinReadySeconds       int32                   `json:"minReadySeconds,omitempty"`
-	PriorityStrategy      *UpdatePriorityStrategy `json:"priorityStrategy,omitempty"`
-	CanaryClusters        []string                `json:"canaryClusters,omitempty"`
-	Paused                bool                    `json:"paused,omitempty"`
-	NeedWaitingForConfirm bool                    `json:"needWaitingForConfirm,omitempty"`
+	UpgradeType      string                  `json:"upgradeType,omitempty"`
+	MinReadySeconds  int32                   `json:"minReadySeconds,omitempty"`
+	PriorityStrategy *UpdatePriorityStrategy `json:"priorityStrategy,omitempty"`
+	// CanaryClusters is a subset of the cluster names in clusterTopology.clusters,
+	// the canary clusters are updated before the others. Every name must reference
+	// a cluster in clusterTopology.clusters, the webhook removes duplicated names and
+	// orders them as clusterTopology.clusters does.
+	// +optional
+	CanaryClusters        []string `json:"canaryClusters,omitempty"`
+	Paused                bool     `json:"paused,omitempty"`
+	NeedWaitingForConfirm bool     `json:"needWaitingForConfirm,omitempty"`
 }
 
 type ClusterTopology struct {
@@ -100,6 +120,11 @@ type TargetCluster struct {
 	// which will be provisioned and managed by UnitedDeployment.
 	// +optional
 	PodSets []*PodSet `json:"podSets,omitempty"`
+
+	// helm values shared by the podSets of the cluster, it is deep merged over the AppSet
+	// rawValues, and the podSet rawValues is deep merged over it.
+	// +optional
+	RawValues string `json:"rawValues,omitempty"`
 }
 
 // AppSetConditionType indicates valid conditions type of a UnitedDeployment.
@@ -160,6 +185,269 @@ type AggrAppSetStatus struct {
 	Pods       []*Pod              `json:"pods,omitempty"`
 	WarnEvents []*Event            `json:"warnEvents,omitempty"`
 	Service    *Service            `json:"service,omitempty"`
+
+	// PodSetReplicas is the resolved replicas of each podSet, percentage replicas
+	// are resolved against spec.replicas.
+	// +optional
+	PodSetReplicas []*PodSetReplicas `json:"podSetReplicas,omitempty"`
+
+	// PodSetValues is the hash of the merged helm values of each podSet, it changes
+	// whenever any values layer of the podSet changes.
+	// +optional
+	PodSetValues []*PodSetValues `json:"podSetValues,omitempty"`
+}
+
+// PodSetReplicas the resolved replicas of the podSet in target cluster
+type PodSetReplicas struct {
+	ClusterName string `json:"clusterName"`
+	Name        string `json:"name"`
+	Replicas    int32  `json:"replicas"`
+}
+
+// PodSetValues the merged helm values hash of the podSet in target cluster
+type PodSetValues struct {
+	ClusterName string `json:"clusterName"`
+	Name        string `json:"name"`
+	// empty if the values layers are invalid
+	Hash string `json:"hash,omitempty"`
+}
+
+// ClusterLister lists the cluster names registered in the multi cluster configuration
+// +kubebuilder:object:generate=false
+type ClusterLister interface {
+	ListClusterNames() ([]string, error)
+}
+
+// AppSetValidator validates AppSet with the registered clusters, implements
+// admission.CustomValidator. If Clusters is nil, it doesn't check whether the target
+// clusters exist.
+// +kubebuilder:object:generate=false
+type AppSetValidator struct {
+	Clusters ClusterLister
+}
+
+var _ admission.CustomValidator = &AppSetValidator{}
+
+// +kubebuilder:webhook:path=/mutate-workload-dmall-com-v1beta1-appset,mutating=true,failurePolicy=fail,sideEffects=None,groups=workload.dmall.com,resources=appsets,verbs=create;update,versions=v1beta1,name=mappset.workload.dmall.com,admissionReviewVersions=v1
+
+// Default makes AppSet an mutating webhook
+// 1. replicas defaults to the sum of podSets replicas when all of them are integer
+// 2. canaryClusters remove duplicated names and keep the clusters order
+func (in *AppSet) Default() {
+	if !in.DeletionTimestamp.IsZero() {
+		return
+	}
+
+	klog.V(4).Info("AppSet: ", in.GetName())
+
+	if in.Spec.Replicas == nil {
+		if replicas, ok := in.sumFixedReplicas(); ok {
+			in.Spec.Replicas = &replicas
+		}
+	}
+
+	if len(in.Spec.UpdateStrategy.CanaryClusters) > 0 {
+		canary := map[string]struct{}{}
+		for _, name := range in.Spec.UpdateStrategy.CanaryClusters {
+			canary[name] = struct{}{}
+		}
+		ordered := make([]string, 0, len(canary))
+		for _, cluster := range in.Spec.ClusterTopology.Clusters {
+			if cluster == nil {
+				continue
+			}
+			if _, ok := canary[cluster.Name]; ok {
+				ordered = append(ordered, cluster.Name)
+				delete(canary, cluster.Name)
+			}
+		}
+		// unknown clusters are kept, the validating webhook will reject them
+		for _, name := range in.Spec.UpdateStrategy.CanaryClusters {
+			if _, ok := canary[name]; ok {
+				ordered = append(ordered, name)
+				delete(canary, name)
+			}
+		}
+		in.Spec.UpdateStrategy.CanaryClusters = ordered
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-workload-dmall-com-v1beta1-appset,mutating=false,failurePolicy=fail,sideEffects=None,groups=workload.dmall.com,resources=appsets,verbs=create;update,versions=v1beta1,name=vappset.workload.dmall.com,admissionReviewVersions=v1
+
+// ValidateCreate implements admission.CustomValidator
+// 1. cluster name is unique and registered, podSets is not empty
+// 2. replicas is equal to the sum of podSets replicas
+// 3. canaryClusters reference clusters in clusterTopology
+func (v *AppSetValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	app, ok := obj.(*AppSet)
+	if !ok {
+		return fmt.Errorf("expect object to be a %T instead of %T", app, obj)
+	}
+	klog.V(4).Info("validate AppSet create: ", app.GetName())
+
+	return app.toInvalidError(app.validate(v.Clusters))
+}
+
+// ValidateUpdate validate AppSet update request
+func (v *AppSetValidator) ValidateUpdate(ctx context.Context, old, obj runtime.Object) error {
+	app, ok := obj.(*AppSet)
+	if !ok {
+		return fmt.Errorf("expect object to be a %T instead of %T", app, obj)
+	}
+	klog.V(4).Info("validate AppSet update: ", app.GetName())
+
+	oldApp, ok := old.(*AppSet)
+	if !ok {
+		return fmt.Errorf("expect old object to be a %T instead of %T", oldApp, old)
+	}
+	if !app.DeletionTimestamp.IsZero() {
+		// only remove finalizers when deleting, don't block it
+		return nil
+	}
+
+	return app.toInvalidError(app.validate(v.Clusters))
+}
+
+// ValidateDelete implements admission.CustomValidator, nothing to validate
+func (v *AppSetValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func (in *AppSet) validate(clusters ClusterLister) field.ErrorList {
+	specPath := field.NewPath("spec")
+	clustersPath := specPath.Child("clusterTopology", "clusters")
+
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validatePodSpec(&in.Spec.PodSpec, specPath.Child("podSpec"))...)
+	allErrs = append(allErrs, validateUpdatePriorityStrategy(in.Spec.UpdateStrategy.PriorityStrategy, specPath.Child("updateStrategy", "priorityStrategy"))...)
+	allErrs = append(allErrs, validateRawValues(in.Spec.RawValues, specPath.Child("rawValues"))...)
+
+	if len(in.Spec.ClusterTopology.Clusters) == 0 {
+		allErrs = append(allErrs, field.Required(clustersPath, "at least one cluster is required"))
+		return allErrs
+	}
+
+	var registered map[string]struct{}
+	if clusters != nil {
+		names, err := clusters.ListClusterNames()
+		if err != nil {
+			allErrs = append(allErrs, field.InternalError(clustersPath, fmt.Errorf("get registered clusters failed: %v", err)))
+		} else {
+			registered = make(map[string]struct{}, len(names))
+			for _, name := range names {
+				registered[name] = struct{}{}
+			}
+		}
+	}
+
+	clusterNames := map[string]struct{}{}
+	for i, cluster := range in.Spec.ClusterTopology.Clusters {
+		idxPath := clustersPath.Index(i)
+		if cluster == nil {
+			allErrs = append(allErrs, field.Required(idxPath, "cluster must not be null"))
+			continue
+		}
+
+		namePath := idxPath.Child("name")
+		if cluster.Name == "" {
+			allErrs = append(allErrs, field.Required(namePath, ""))
+		} else {
+			if _, ok := clusterNames[cluster.Name]; ok {
+				allErrs = append(allErrs, field.Duplicate(namePath, cluster.Name))
+			}
+			clusterNames[cluster.Name] = struct{}{}
+			if registered != nil {
+				if _, ok := registered[cluster.Name]; !ok {
+					allErrs = append(allErrs, field.NotFound(namePath, cluster.Name))
+				}
+			}
+		}
+
+		allErrs = append(allErrs, validateRawValues(cluster.RawValues, idxPath.Child("rawValues"))...)
+
+		if len(cluster.PodSets) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("podSets"), "at least one podSet is required"))
+			continue
+		}
+		allErrs = append(allErrs, validatePodSets(cluster.PodSets, idxPath.Child("podSets"))...)
+	}
+
+	for i, name := range in.Spec.UpdateStrategy.CanaryClusters {
+		if _, ok := clusterNames[name]; !ok {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("updateStrategy", "canaryClusters").Index(i), name, "must reference a cluster in spec.clusterTopology.clusters"))
+		}
+	}
+
+	allErrs = append(allErrs, in.validateReplicas(specPath.Child("replicas"))...)
+	return allErrs
+}
+
+// validateReplicas the sum of fixed podSets replicas must equal spec.replicas, if some podSets
+// replicas is percentage or nil, it must not exceed spec.replicas.
+func (in *AppSet) validateReplicas(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	var fixed int32
+	allFixed := true
+	for _, cluster := range in.Spec.ClusterTopology.Clusters {
+		if cluster == nil {
+			continue
+		}
+		for _, podSet := range cluster.PodSets {
+			if podSet == nil {
+				continue
+			}
+			if podSet.Replicas == nil || podSet.Replicas.Type != intstr.Int {
+				allFixed = false
+				continue
+			}
+			fixed += podSet.Replicas.IntVal
+		}
+	}
+
+	if in.Spec.Replicas == nil {
+		if !allFixed {
+			allErrs = append(allErrs, field.Required(fldPath, "replicas is required when podSets replicas is percentage or nil"))
+		}
+		return allErrs
+	}
+
+	replicas := *in.Spec.Replicas
+	if replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, replicas, "must be greater than or equal to 0"))
+		return allErrs
+	}
+	if allFixed && fixed != replicas {
+		allErrs = append(allErrs, field.Invalid(fldPath, replicas, fmt.Sprintf("must be equal to the sum of podSets replicas %d", fixed)))
+	}
+	if !allFixed && fixed > replicas {
+		allErrs = append(allErrs, field.Invalid(fldPath, replicas, fmt.Sprintf("must not be less than the sum of fixed podSets replicas %d", fixed)))
+	}
+	return allErrs
+}
+
+// sumFixedReplicas returns the sum of podSets replicas, false if any of them is not integer
+func (in *AppSet) sumFixedReplicas() (int32, bool) {
+	var sum int32
+	for _, cluster := range in.Spec.ClusterTopology.Clusters {
+		if cluster == nil {
+			continue
+		}
+		for _, podSet := range cluster.PodSets {
+			if podSet == nil || podSet.Replicas == nil || podSet.Replicas.Type != intstr.Int {
+				return 0, false
+			}
+			sum += podSet.Replicas.IntVal
+		}
+	}
+	return sum, true
+}
+
+func (in *AppSet) toInvalidError(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "AppSet"}, in.Name, allErrs)
 }
 
 func init() {
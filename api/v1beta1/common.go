@@ -107,19 +107,125 @@ type Service struct {
 
 // ChartURL char url info
 type ChartURL struct {
-	URL          string `json:"url,omitempty"`
+	// chart package url, chart repository url with chart name, or OCI reference like
+	// oci://registry.example.com/charts/nginx
+	URL string `json:"url,omitempty"`
+	// semver version or constraint for chart repository, tag for OCI reference
 	ChartVersion string `json:"chartVersion,omitempty"`
+	// the name of Secret in the AdvDeployment namespace which holds the credentials,
+	// with keys username and password, or a .dockerconfigjson for OCI registry. The AppSet
+	// master copies it to the target clusters with the AdvDeployment.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// ResourceKeySelector selects a key of ConfigMap or Secret in the same namespace
+type ResourceKeySelector struct {
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// the key of data, chart.tgz for chartFrom, manifests.yaml for chartFrom of manifests and
+	// values.yaml for valuesFrom by default
+	// +optional
+	Key string `json:"key,omitempty"`
 }
 
+// ResourceKeySelector kind enum
+const (
+	ResourceKindConfigMap = "ConfigMap"
+	ResourceKindSecret    = "Secret"
+)
+
 // ChartSpec charspec with raw content
 type ChartSpec struct {
 	RawChart *[]byte   `json:"rawChart,omitempty"`
 	CharURL  *ChartURL `json:"chartUrl,omitempty"`
+	// the chart package in ConfigMap binaryData or Secret, it keeps large charts out of the
+	// resource. The AppSet master copies it to the target clusters with the AdvDeployment.
+	// +optional
+	ChartFrom *ResourceKeySelector `json:"chartFrom,omitempty"`
+	// the multi-document YAML bundle when deployType is manifests, ${key} is replaced with the
+	// podSet meta. It takes precedence over chartFrom, which is manifests.yaml by default.
+	// +optional
+	RawManifests string `json:"rawManifests,omitempty"`
+	// the kustomization directory in the chart tarball when deployType is kustomize, the root of
+	// tarball by default. Every podSet builds it with the podSet name suffix and label.
+	// +optional
+	KustomizePath string `json:"kustomizePath,omitempty"`
+	// the podSet overlay on top of kustomizePath when deployType is kustomize, it refers to the
+	// resources by the names in tarball. The podSet one takes precedence over the global one.
+	// +optional
+	Kustomize *KustomizeOverlay `json:"kustomize,omitempty"`
+}
+
+// KustomizeOverlay the patches, images and replicas fields of kustomization
+type KustomizeOverlay struct {
+	// +optional
+	Patches []KustomizePatch `json:"patches,omitempty"`
+	// +optional
+	Images []KustomizeImage `json:"images,omitempty"`
+	// +optional
+	Replicas []KustomizeReplica `json:"replicas,omitempty"`
+}
+
+// KustomizePatch a strategic merge or JSON6902 patch, it is applied to the target resources or
+// the resource of the same name and kind in strategic merge patch without target.
+type KustomizePatch struct {
+	Patch string `json:"patch"`
+	// +optional
+	Target *KustomizeSelector `json:"target,omitempty"`
+}
+
+// KustomizeSelector selects the resources to patch, names are regular expressions
+type KustomizeSelector struct {
+	// +optional
+	Group string `json:"group,omitempty"`
+	// +optional
+	Version string `json:"version,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Name string `json:"name,omitempty"`
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// +optional
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
 }
 
+// KustomizeImage overrides the name, tag or digest of the images named Name
+type KustomizeImage struct {
+	Name string `json:"name"`
+	// +optional
+	NewName string `json:"newName,omitempty"`
+	// +optional
+	NewTag string `json:"newTag,omitempty"`
+	// +optional
+	Digest string `json:"digest,omitempty"`
+}
+
+// KustomizeReplica overrides the replicas of the workload named Name
+type KustomizeReplica struct {
+	Name string `json:"name"`
+	// +kubebuilder:validation:Minimum=0
+	Count int64 `json:"count"`
+}
+
+// DeployType enum
+const (
+	DeployTypeHelm        = "helm"
+	DeployTypeInPlaceSet  = "InPlaceSet"
+	DeployTypeStatefulSet = "StatefulSet"
+	DeployTypeDeployment  = "deployment"
+	DeployTypeManifests   = "manifests"
+	DeployTypeKustomize   = "kustomize"
+)
+
 // PodSpec pod spec info
 type PodSpec struct {
-	// support PodSet：helm, InPlaceSet，StatefulSet, deployment
+	// support PodSet：helm, InPlaceSet，StatefulSet, deployment, manifests, kustomize, InPlaceSet is
+	// not supported yet. StatefulSet and deployment build one workload per podSet from selector and
+	// template, manifests applies the YAML bundle of chart for every podSet, and kustomize builds
+	// the kustomization in the chart tarball for every podSet.
 	// Default value is deployment
 	// +optional
 	DeployType string `json:"deployType,omitempty"`
@@ -130,6 +236,14 @@ type PodSpec struct {
 	Chart    *ChartSpec              `json:"chart,omitempty"`
 }
 
+// GetDeployType returns the deploy type, deployment if it is empty
+func (in *PodSpec) GetDeployType() string {
+	if in.DeployType == "" {
+		return DeployTypeDeployment
+	}
+	return in.DeployType
+}
+
 // PodSetStatusInfo pod status info
 type PodSetStatusInfo struct {
 	Name          string `json:"name"`
@@ -175,9 +289,16 @@ type PodSet struct {
 	// the override podset chart spec
 	Chart *ChartSpec `json:"chart,omitempty"`
 
-	// use for helm
+	// use for helm, the worker merges it over the .Values.sym values which contain
+	// replicas, podSetName, podSetMeta, clusterName and zone.
 	RawValues string `json:"rawValues,omitempty"`
 
+	// values files in ConfigMaps or Secrets, the latter takes precedence over the former,
+	// and rawValues takes precedence over all of them. The AppSet master copies them to the
+	// target clusters with the AdvDeployment.
+	// +optional
+	ValuesFrom []*ResourceKeySelector `json:"valuesFrom,omitempty"`
+
 	// exp: bule/green, rz/gz
 	Mata map[string]string `json:"meta,omitempty"`
 }
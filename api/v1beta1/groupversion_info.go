@@ -16,7 +16,7 @@ limitations under the License.
 
 // Package v1beta1 contains API Schema definitions for the workload v1beta1 API group
 // +kubebuilder:object:generate=true
-// +groupName=workload.dmall.domain
+// +groupName=workload.dmall.com
 package v1beta1
 
 import (
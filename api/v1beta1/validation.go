@@ -0,0 +1,288 @@
+/*
+Copyright 2021 symcn.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// supportedDeployTypes the deploy types which the worker is able to reconcile
+var supportedDeployTypes = []string{DeployTypeHelm, DeployTypeDeployment, DeployTypeStatefulSet, DeployTypeManifests, DeployTypeKustomize}
+
+func validatePodSpec(spec *PodSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	deployType := spec.GetDeployType()
+	if !containsString(supportedDeployTypes, deployType) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("deployType"), spec.DeployType, supportedDeployTypes))
+		return allErrs
+	}
+	if deployType == DeployTypeManifests {
+		return append(allErrs, validateManifestsSpec(spec, fldPath)...)
+	}
+	if deployType != DeployTypeHelm && deployType != DeployTypeKustomize {
+		return append(allErrs, validateWorkloadSpec(spec, fldPath)...)
+	}
+
+	chartPath := fldPath.Child("chart")
+	if spec.Chart == nil {
+		allErrs = append(allErrs, field.Required(chartPath, "chart is required when deployType is "+spec.DeployType))
+		return allErrs
+	}
+	if spec.Chart.RawChart == nil && spec.Chart.CharURL == nil && spec.Chart.ChartFrom == nil {
+		allErrs = append(allErrs, field.Required(chartPath, "one of rawChart, chartUrl or chartFrom is required"))
+	}
+	allErrs = append(allErrs, validateChartSpec(spec.Chart, chartPath)...)
+	return allErrs
+}
+
+// validateWorkloadSpec the selector and template are required to build workloads without chart,
+// and the selector must match the template labels.
+func validateWorkloadSpec(spec *PodSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	selectorPath := fldPath.Child("selector")
+	if spec.Selector == nil {
+		allErrs = append(allErrs, field.Required(selectorPath, "selector is required when deployType is "+spec.GetDeployType()))
+	}
+	if spec.Template == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("template"), "template is required when deployType is "+spec.GetDeployType()))
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	allErrs = append(allErrs, metav1validation.ValidateLabelSelector(spec.Selector, selectorPath)...)
+	selector, err := metav1.LabelSelectorAsSelector(spec.Selector)
+	if err != nil {
+		return allErrs
+	}
+	if selector.Empty() {
+		allErrs = append(allErrs, field.Invalid(selectorPath, spec.Selector, "empty selector is invalid"))
+	} else if !selector.Matches(labels.Set(spec.Template.Labels)) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("template", "metadata", "labels"), spec.Template.Labels, "selector does not match template labels"))
+	}
+	return allErrs
+}
+
+// validateManifestsSpec the YAML bundle is inline in rawManifests or referenced by chartFrom
+func validateManifestsSpec(spec *PodSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	chartPath := fldPath.Child("chart")
+	if spec.Chart == nil {
+		return append(allErrs, field.Required(chartPath, "chart is required when deployType is "+spec.DeployType))
+	}
+	if spec.Chart.RawManifests == "" && spec.Chart.ChartFrom == nil {
+		return append(allErrs, field.Required(chartPath, "one of rawManifests or chartFrom is required"))
+	}
+	if spec.Chart.ChartFrom != nil {
+		allErrs = append(allErrs, validateResourceKeySelector(spec.Chart.ChartFrom, chartPath.Child("chartFrom"))...)
+	}
+	return allErrs
+}
+
+func validateChartSpec(chart *ChartSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if chart.RawChart != nil && len(*chart.RawChart) == 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("rawChart"), "", "rawChart must not be empty"))
+	}
+	if chart.CharURL != nil && chart.CharURL.URL == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("chartUrl", "url"), ""))
+	}
+	if chart.ChartFrom != nil {
+		allErrs = append(allErrs, validateResourceKeySelector(chart.ChartFrom, fldPath.Child("chartFrom"))...)
+	}
+	return allErrs
+}
+
+func validateResourceKeySelector(selector *ResourceKeySelector, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if selector.Kind != ResourceKindConfigMap && selector.Kind != ResourceKindSecret {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("kind"), selector.Kind, []string{ResourceKindConfigMap, ResourceKindSecret}))
+	}
+	if selector.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(selector.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("name"), selector.Name, msg))
+		}
+	}
+	if selector.Key != "" {
+		for _, msg := range validation.IsConfigMapKey(selector.Key) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("key"), selector.Key, msg))
+		}
+	}
+	return allErrs
+}
+
+func validatePodSets(podSets []*PodSet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	names := map[string]struct{}{}
+	for i, podSet := range podSets {
+		idxPath := fldPath.Index(i)
+		if podSet == nil {
+			allErrs = append(allErrs, field.Required(idxPath, "podSet must not be null"))
+			continue
+		}
+
+		namePath := idxPath.Child("name")
+		if podSet.Name == "" {
+			allErrs = append(allErrs, field.Required(namePath, ""))
+		} else {
+			for _, msg := range validation.IsDNS1123Label(podSet.Name) {
+				allErrs = append(allErrs, field.Invalid(namePath, podSet.Name, msg))
+			}
+			if _, ok := names[podSet.Name]; ok {
+				allErrs = append(allErrs, field.Duplicate(namePath, podSet.Name))
+			}
+			names[podSet.Name] = struct{}{}
+		}
+
+		if podSet.Replicas != nil {
+			allErrs = append(allErrs, validateReplicas(podSet.Replicas, idxPath.Child("replicas"))...)
+		}
+		if podSet.Chart != nil {
+			allErrs = append(allErrs, validateChartSpec(podSet.Chart, idxPath.Child("chart"))...)
+		}
+		allErrs = append(allErrs, validateRawValues(podSet.RawValues, idxPath.Child("rawValues"))...)
+		for j, selector := range podSet.ValuesFrom {
+			if selector == nil {
+				allErrs = append(allErrs, field.Required(idxPath.Child("valuesFrom").Index(j), "valuesFrom must not be null"))
+				continue
+			}
+			allErrs = append(allErrs, validateResourceKeySelector(selector, idxPath.Child("valuesFrom").Index(j))...)
+		}
+	}
+	return allErrs
+}
+
+// validateRawValues rawValues must be a yaml map
+func validateRawValues(rawValues string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if strings.TrimSpace(rawValues) == "" {
+		return allErrs
+	}
+	if err := yaml.Unmarshal([]byte(rawValues), &map[string]interface{}{}); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", fmt.Sprintf("must be a yaml map: %v", err)))
+	}
+	return allErrs
+}
+
+// validateReplicas replicas must be a non-negative integer or a percentage between 0% and 100%
+func validateReplicas(replicas *intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	switch replicas.Type {
+	case intstr.Int:
+		if replicas.IntVal < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath, replicas.IntVal, "must be greater than or equal to 0"))
+		}
+	case intstr.String:
+		if !strings.HasSuffix(replicas.StrVal, "%") {
+			allErrs = append(allErrs, field.Invalid(fldPath, replicas.StrVal, "must be an integer or a percentage like '10%'"))
+			return allErrs
+		}
+		v, err := strconv.Atoi(strings.TrimSuffix(replicas.StrVal, "%"))
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, replicas.StrVal, "must be an integer or a percentage like '10%'"))
+			return allErrs
+		}
+		if v < 0 || v > 100 {
+			allErrs = append(allErrs, field.Invalid(fldPath, replicas.StrVal, "percentage must be between 0% and 100%"))
+		}
+	default:
+		allErrs = append(allErrs, field.Invalid(fldPath, replicas, "unknown intstr type"))
+	}
+	return allErrs
+}
+
+func validateUpdatePriorityStrategy(strategy *UpdatePriorityStrategy, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if strategy == nil {
+		return allErrs
+	}
+
+	if len(strategy.OrderPriority) > 0 && len(strategy.WeightPriority) > 0 {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only one of orderPriority and weightPriority can be set"))
+		return allErrs
+	}
+
+	for i, term := range strategy.OrderPriority {
+		keyPath := fldPath.Child("orderPriority").Index(i).Child("orderedKey")
+		if term.OrderedKey == "" {
+			allErrs = append(allErrs, field.Required(keyPath, ""))
+			continue
+		}
+		for _, msg := range validation.IsQualifiedName(term.OrderedKey) {
+			allErrs = append(allErrs, field.Invalid(keyPath, term.OrderedKey, msg))
+		}
+	}
+
+	for i, term := range strategy.WeightPriority {
+		idxPath := fldPath.Child("weightPriority").Index(i)
+		if term.Weight < 1 || term.Weight > 100 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("weight"), term.Weight, "must be in the range 1-100"))
+		}
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(&term.MatchSelector, idxPath.Child("matchSelector"))...)
+	}
+	return allErrs
+}
+
+// validatePodSetsUpdate a subset's nodeSelectorTerm is not allowed to be updated
+func validatePodSetsUpdate(podSets, oldPodSets []*PodSet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	old := map[string]*PodSet{}
+	for _, podSet := range oldPodSets {
+		if podSet != nil {
+			old[podSet.Name] = podSet
+		}
+	}
+	for i, podSet := range podSets {
+		if podSet == nil {
+			continue
+		}
+		oldPodSet, ok := old[podSet.Name]
+		if !ok {
+			continue
+		}
+		if !equality.Semantic.DeepEqual(podSet.NodeSelectorTerm, oldPodSet.NodeSelectorTerm) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Index(i).Child("nodeSelectorTerm"), "nodeSelectorTerm is immutable"))
+		}
+	}
+	return allErrs
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
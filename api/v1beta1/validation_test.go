@@ -0,0 +1,544 @@
+package v1beta1
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newValidAdvDeployment() *AdvDeployment {
+	rawChart := []byte("chart")
+	replicas := intstr.FromInt(1)
+	return &AdvDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+		Spec: AdvDeploymentSpec{
+			PodSpec: PodSpec{
+				DeployType: DeployTypeHelm,
+				Chart: &ChartSpec{
+					RawChart: &rawChart,
+				},
+			},
+			Topology: Topology{
+				PodSets: []*PodSet{
+					{
+						Name:     "app-gz01a-blue",
+						Replicas: &replicas,
+						NodeSelectorTerm: &corev1.NodeSelectorTerm{
+							MatchExpressions: []corev1.NodeSelectorRequirement{
+								{
+									Key:      "zone",
+									Operator: corev1.NodeSelectorOpIn,
+									Values:   []string{"gz01"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestAdvDeploymentValidateCreate(t *testing.T) {
+	args := []struct {
+		name     string
+		modify   func(adv *AdvDeployment)
+		errField string
+	}{
+		{
+			name:   "valid",
+			modify: func(adv *AdvDeployment) {},
+		},
+		{
+			name: "unsupported deploy type",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec.DeployType = "unknown"
+			},
+			errField: "spec.podSpec.deployType",
+		},
+		{
+			name: "chart is nil",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec.Chart = nil
+			},
+			errField: "spec.podSpec.chart",
+		},
+		{
+			name: "chart without source",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec.Chart = &ChartSpec{}
+			},
+			errField: "spec.podSpec.chart",
+		},
+		{
+			name: "deployment",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{
+					DeployType: DeployTypeDeployment,
+					Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+					Template:   &corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "app"}}},
+				}
+			},
+		},
+		{
+			name: "default deploy type without template",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+				}
+			},
+			errField: "spec.podSpec.template",
+		},
+		{
+			name: "statefulset selector not match template",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{
+					DeployType: DeployTypeStatefulSet,
+					Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+					Template:   &corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "other"}}},
+				}
+			},
+			errField: "spec.podSpec.template.metadata.labels",
+		},
+		{
+			name: "manifests",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{
+					DeployType: DeployTypeManifests,
+					Chart:      &ChartSpec{RawManifests: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app-${color}\n"},
+				}
+			},
+		},
+		{
+			name: "manifests without source",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{
+					DeployType: DeployTypeManifests,
+					Chart:      &ChartSpec{CharURL: &ChartURL{URL: "https://charts.example.com/app"}},
+				}
+			},
+			errField: "spec.podSpec.chart",
+		},
+		{
+			name: "kustomize",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{
+					DeployType: DeployTypeKustomize,
+					Chart:      &ChartSpec{ChartFrom: &ResourceKeySelector{Kind: ResourceKindConfigMap, Name: "app-kustomize"}, KustomizePath: "overlays/rz"},
+				}
+			},
+		},
+		{
+			name: "kustomize without chart",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec = PodSpec{DeployType: DeployTypeKustomize}
+			},
+			errField: "spec.podSpec.chart",
+		},
+		{
+			name: "chart from configmap",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec.Chart = &ChartSpec{ChartFrom: &ResourceKeySelector{Kind: ResourceKindConfigMap, Name: "app-chart"}}
+			},
+		},
+		{
+			name: "chart from unsupported kind",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.PodSpec.Chart = &ChartSpec{ChartFrom: &ResourceKeySelector{Kind: "Pod", Name: "app-chart"}}
+			},
+			errField: "spec.podSpec.chart.chartFrom.kind",
+		},
+		{
+			name: "values from without name",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.Topology.PodSets[0].ValuesFrom = []*ResourceKeySelector{{Kind: ResourceKindSecret}}
+			},
+			errField: "spec.topology.podSets[0].valuesFrom[0].name",
+		},
+		{
+			name: "podset name is not dns label",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.Topology.PodSets[0].Name = "App_Blue"
+			},
+			errField: "spec.topology.podSets[0].name",
+		},
+		{
+			name: "duplicate podset name",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.Topology.PodSets = append(adv.Spec.Topology.PodSets, adv.Spec.Topology.PodSets[0].DeepCopy())
+			},
+			errField: "spec.topology.podSets[1].name",
+		},
+		{
+			name: "percentage replicas",
+			modify: func(adv *AdvDeployment) {
+				replicas := intstr.FromString("10%")
+				adv.Spec.Topology.PodSets[0].Replicas = &replicas
+			},
+		},
+		{
+			name: "invalid string replicas",
+			modify: func(adv *AdvDeployment) {
+				replicas := intstr.FromString("ten")
+				adv.Spec.Topology.PodSets[0].Replicas = &replicas
+			},
+			errField: "spec.topology.podSets[0].replicas",
+		},
+		{
+			name: "percentage replicas out of range",
+			modify: func(adv *AdvDeployment) {
+				replicas := intstr.FromString("101%")
+				adv.Spec.Topology.PodSets[0].Replicas = &replicas
+			},
+			errField: "spec.topology.podSets[0].replicas",
+		},
+		{
+			name: "negative replicas",
+			modify: func(adv *AdvDeployment) {
+				replicas := intstr.FromInt(-1)
+				adv.Spec.Topology.PodSets[0].Replicas = &replicas
+			},
+			errField: "spec.topology.podSets[0].replicas",
+		},
+		{
+			name: "both order and weight priority",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.UpdateStrategy.PriorityStrategy = &UpdatePriorityStrategy{
+					OrderPriority:  []UpdatePriorityOrderTerm{{OrderedKey: "key"}},
+					WeightPriority: []UpdatePriorityWeightTerm{{Weight: 10}},
+				}
+			},
+			errField: "spec.updateStrategy.priorityStrategy",
+		},
+		{
+			name: "weight out of range",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.UpdateStrategy.PriorityStrategy = &UpdatePriorityStrategy{
+					WeightPriority: []UpdatePriorityWeightTerm{{Weight: 101}},
+				}
+			},
+			errField: "spec.updateStrategy.priorityStrategy.weightPriority[0].weight",
+		},
+		{
+			name: "empty ordered key",
+			modify: func(adv *AdvDeployment) {
+				adv.Spec.UpdateStrategy.PriorityStrategy = &UpdatePriorityStrategy{
+					OrderPriority: []UpdatePriorityOrderTerm{{OrderedKey: ""}},
+				}
+			},
+			errField: "spec.updateStrategy.priorityStrategy.orderPriority[0].orderedKey",
+		},
+	}
+
+	for _, ut := range args {
+		t.Run(ut.name, func(t *testing.T) {
+			adv := newValidAdvDeployment()
+			ut.modify(adv)
+			err := adv.ValidateCreate()
+			if ut.errField == "" {
+				if err != nil {
+					t.Errorf("expect no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("expect error on field %s, but got nil", ut.errField)
+				return
+			}
+			if !apierrors.IsInvalid(err) {
+				t.Errorf("expect invalid error, but got %v", err)
+				return
+			}
+			if !strings.Contains(err.Error(), ut.errField) {
+				t.Errorf("expect error on field %s, but got %v", ut.errField, err)
+			}
+		})
+	}
+}
+
+func TestAdvDeploymentValidateUpdate(t *testing.T) {
+	old := newValidAdvDeployment()
+
+	// not modify
+	adv := newValidAdvDeployment()
+	if err := adv.ValidateUpdate(old); err != nil {
+		t.Errorf("expect no error, but got %v", err)
+		return
+	}
+
+	// old object type is error
+	if err := adv.ValidateUpdate(&AppSet{}); err == nil {
+		t.Error("old object type is not AdvDeployment must have error")
+		return
+	}
+
+	// add new podset with nodeSelectorTerm
+	adv = newValidAdvDeployment()
+	podSet := adv.Spec.Topology.PodSets[0].DeepCopy()
+	podSet.Name = "app-gz01a-green"
+	podSet.NodeSelectorTerm = nil
+	adv.Spec.Topology.PodSets = append(adv.Spec.Topology.PodSets, podSet)
+	if err := adv.ValidateUpdate(old); err != nil {
+		t.Errorf("expect no error, but got %v", err)
+		return
+	}
+
+	// modify nodeSelectorTerm
+	adv = newValidAdvDeployment()
+	adv.Spec.Topology.PodSets[0].NodeSelectorTerm.MatchExpressions[0].Values = []string{"gz02"}
+	err := adv.ValidateUpdate(old)
+	if err == nil {
+		t.Error("modify nodeSelectorTerm must have error")
+		return
+	}
+	if !strings.Contains(err.Error(), "spec.topology.podSets[0].nodeSelectorTerm") {
+		t.Errorf("expect nodeSelectorTerm field error, but got %v", err)
+	}
+
+	// invalid object created before the webhook, the unchanged fields are not validated
+	invalidOld := newValidAdvDeployment()
+	invalidOld.Spec.PodSpec.DeployType = "unknown"
+	adv = invalidOld.DeepCopy()
+	adv.Finalizers = []string{"sym-ops"}
+	if err := adv.ValidateUpdate(invalidOld); err != nil {
+		t.Errorf("expect unchanged invalid fields not validated, but got %v", err)
+	}
+	adv.Spec.Topology.PodSets[0].Name = "Invalid_Name"
+	if err := adv.ValidateUpdate(invalidOld); err == nil || strings.Contains(err.Error(), "spec.podSpec") {
+		t.Errorf("expect only podSets error, but got %v", err)
+	}
+
+	// deleting, finalizers are removed
+	now := metav1.Now()
+	adv.DeletionTimestamp = &now
+	adv.Finalizers = nil
+	if err := adv.ValidateUpdate(invalidOld); err != nil {
+		t.Errorf("expect deleting object not validated, but got %v", err)
+	}
+}
+
+func newValidAppSet() *AppSet {
+	rawChart := []byte("chart")
+	total := int32(3)
+	one := intstr.FromInt(1)
+	two := intstr.FromInt(2)
+	return &AppSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+		Spec: AppSetSpec{
+			Replicas: &total,
+			PodSpec: PodSpec{
+				DeployType: DeployTypeHelm,
+				Chart: &ChartSpec{
+					RawChart: &rawChart,
+				},
+			},
+			ClusterTopology: ClusterTopology{
+				Clusters: []*TargetCluster{
+					{
+						Name:    "cluster-a",
+						PodSets: []*PodSet{{Name: "app-gz01a-blue", Replicas: &one}},
+					},
+					{
+						Name:    "cluster-b",
+						PodSets: []*PodSet{{Name: "app-gz01b-blue", Replicas: &two}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestAppSetDefault(t *testing.T) {
+	app := newValidAppSet()
+	app.Spec.Replicas = nil
+	app.Spec.UpdateStrategy.CanaryClusters = []string{"cluster-b", "unknown", "cluster-a", "cluster-b"}
+	app.Default()
+
+	if app.Spec.Replicas == nil || *app.Spec.Replicas != 3 {
+		t.Errorf("expect replicas default to 3, but got %v", app.Spec.Replicas)
+		return
+	}
+	if !reflect.DeepEqual(app.Spec.UpdateStrategy.CanaryClusters, []string{"cluster-a", "cluster-b", "unknown"}) {
+		t.Errorf("expect canaryClusters ordered and unique, but got %v", app.Spec.UpdateStrategy.CanaryClusters)
+		return
+	}
+
+	// percentage replicas not default
+	app = newValidAppSet()
+	app.Spec.Replicas = nil
+	percent := intstr.FromString("50%")
+	app.Spec.ClusterTopology.Clusters[0].PodSets[0].Replicas = &percent
+	app.Default()
+	if app.Spec.Replicas != nil {
+		t.Errorf("expect replicas not default with percentage podSet, but got %d", *app.Spec.Replicas)
+	}
+}
+
+type fakeClusterLister []string
+
+func (l fakeClusterLister) ListClusterNames() ([]string, error) {
+	return l, nil
+}
+
+func TestAppSetValidateCreate(t *testing.T) {
+	args := []struct {
+		name       string
+		modify     func(app *AppSet)
+		registered []string
+		errField   string
+	}{
+		{
+			name:   "valid",
+			modify: func(app *AppSet) {},
+		},
+		{
+			name:       "registered clusters",
+			modify:     func(app *AppSet) {},
+			registered: []string{"cluster-a", "cluster-b", "cluster-c"},
+		},
+		{
+			name:       "unknown cluster",
+			modify:     func(app *AppSet) {},
+			registered: []string{"cluster-a"},
+			errField:   "spec.clusterTopology.clusters[1].name",
+		},
+		{
+			name: "empty clusters",
+			modify: func(app *AppSet) {
+				app.Spec.ClusterTopology.Clusters = nil
+			},
+			errField: "spec.clusterTopology.clusters",
+		},
+		{
+			name: "duplicate cluster",
+			modify: func(app *AppSet) {
+				app.Spec.ClusterTopology.Clusters[1].Name = "cluster-a"
+			},
+			errField: "spec.clusterTopology.clusters[1].name",
+		},
+		{
+			name: "empty podsets",
+			modify: func(app *AppSet) {
+				app.Spec.ClusterTopology.Clusters[1].PodSets = nil
+			},
+			errField: "spec.clusterTopology.clusters[1].podSets",
+		},
+		{
+			name: "replicas mismatch",
+			modify: func(app *AppSet) {
+				replicas := int32(4)
+				app.Spec.Replicas = &replicas
+			},
+			errField: "spec.replicas",
+		},
+		{
+			name: "percentage replicas",
+			modify: func(app *AppSet) {
+				percent := intstr.FromString("50%")
+				app.Spec.ClusterTopology.Clusters[0].PodSets[0].Replicas = &percent
+			},
+		},
+		{
+			name: "nil replicas without total",
+			modify: func(app *AppSet) {
+				app.Spec.Replicas = nil
+				app.Spec.ClusterTopology.Clusters[0].PodSets[0].Replicas = nil
+			},
+			errField: "spec.replicas",
+		},
+		{
+			name: "fixed replicas exceed total",
+			modify: func(app *AppSet) {
+				replicas := int32(1)
+				app.Spec.Replicas = &replicas
+				app.Spec.ClusterTopology.Clusters[0].PodSets[0].Replicas = nil
+			},
+			errField: "spec.replicas",
+		},
+		{
+			name: "unknown canary cluster",
+			modify: func(app *AppSet) {
+				app.Spec.UpdateStrategy.CanaryClusters = []string{"cluster-c"}
+			},
+			errField: "spec.updateStrategy.canaryClusters[0]",
+		},
+		{
+			name: "invalid podset name",
+			modify: func(app *AppSet) {
+				app.Spec.ClusterTopology.Clusters[0].PodSets[0].Name = "Blue"
+			},
+			errField: "spec.clusterTopology.clusters[0].podSets[0].name",
+		},
+		{
+			name: "values layers",
+			modify: func(app *AppSet) {
+				app.Spec.RawValues = "image: app\n"
+				app.Spec.ClusterTopology.Clusters[0].RawValues = "zone: gz\n"
+				app.Spec.ClusterTopology.Clusters[0].PodSets[0].RawValues = "color: blue\n"
+			},
+		},
+		{
+			name: "invalid appset values",
+			modify: func(app *AppSet) {
+				app.Spec.RawValues = "- image\n"
+			},
+			errField: "spec.rawValues",
+		},
+		{
+			name: "invalid cluster values",
+			modify: func(app *AppSet) {
+				app.Spec.ClusterTopology.Clusters[1].RawValues = "zone: [gz"
+			},
+			errField: "spec.clusterTopology.clusters[1].rawValues",
+		},
+		{
+			name: "invalid podset values",
+			modify: func(app *AppSet) {
+				app.Spec.ClusterTopology.Clusters[0].PodSets[0].RawValues = "color"
+			},
+			errField: "spec.clusterTopology.clusters[0].podSets[0].rawValues",
+		},
+	}
+
+	for _, ut := range args {
+		t.Run(ut.name, func(t *testing.T) {
+			v := &AppSetValidator{}
+			if ut.registered != nil {
+				v.Clusters = fakeClusterLister(ut.registered)
+			}
+
+			app := newValidAppSet()
+			ut.modify(app)
+			err := v.ValidateCreate(context.TODO(), app)
+			if ut.errField == "" {
+				if err != nil {
+					t.Errorf("expect no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("expect error on field %s, but got nil", ut.errField)
+				return
+			}
+			if !apierrors.IsInvalid(err) {
+				t.Errorf("expect invalid error, but got %v", err)
+				return
+			}
+			if !strings.Contains(err.Error(), ut.errField) {
+				t.Errorf("expect error on field %s, but got %v", ut.errField, err)
+			}
+		})
+	}
+}
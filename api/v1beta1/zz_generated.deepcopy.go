@@ -273,6 +273,28 @@ func (in *AggrAppSetStatus) DeepCopyInto(out *AggrAppSetStatus) {
 		*out = new(Service)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PodSetReplicas != nil {
+		in, out := &in.PodSetReplicas, &out.PodSetReplicas
+		*out = make([]*PodSetReplicas, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(PodSetReplicas)
+				**out = **in
+			}
+		}
+	}
+	if in.PodSetValues != nil {
+		in, out := &in.PodSetValues, &out.PodSetValues
+		*out = make([]*PodSetValues, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(PodSetValues)
+				**out = **in
+			}
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggrAppSetStatus.
@@ -471,6 +493,16 @@ func (in *ChartSpec) DeepCopyInto(out *ChartSpec) {
 		*out = new(ChartURL)
 		**out = **in
 	}
+	if in.ChartFrom != nil {
+		in, out := &in.ChartFrom, &out.ChartFrom
+		*out = new(ResourceKeySelector)
+		**out = **in
+	}
+	if in.Kustomize != nil {
+		in, out := &in.Kustomize, &out.Kustomize
+		*out = new(KustomizeOverlay)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartSpec.
@@ -587,6 +619,103 @@ func (in *Event) DeepCopy() *Event {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizeImage) DeepCopyInto(out *KustomizeImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizeImage.
+func (in *KustomizeImage) DeepCopy() *KustomizeImage {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizeImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizeOverlay) DeepCopyInto(out *KustomizeOverlay) {
+	*out = *in
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]KustomizePatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]KustomizeImage, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = make([]KustomizeReplica, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizeOverlay.
+func (in *KustomizeOverlay) DeepCopy() *KustomizeOverlay {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizeOverlay)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizePatch) DeepCopyInto(out *KustomizePatch) {
+	*out = *in
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(KustomizeSelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizePatch.
+func (in *KustomizePatch) DeepCopy() *KustomizePatch {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizePatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizeReplica) DeepCopyInto(out *KustomizeReplica) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizeReplica.
+func (in *KustomizeReplica) DeepCopy() *KustomizeReplica {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizeReplica)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizeSelector) DeepCopyInto(out *KustomizeSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizeSelector.
+func (in *KustomizeSelector) DeepCopy() *KustomizeSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizeSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Pod) DeepCopyInto(out *Pod) {
 	*out = *in
@@ -621,6 +750,17 @@ func (in *PodSet) DeepCopyInto(out *PodSet) {
 		*out = new(ChartSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]*ResourceKeySelector, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(ResourceKeySelector)
+				**out = **in
+			}
+		}
+	}
 	if in.Mata != nil {
 		in, out := &in.Mata, &out.Mata
 		*out = make(map[string]string, len(*in))
@@ -640,6 +780,21 @@ func (in *PodSet) DeepCopy() *PodSet {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetReplicas) DeepCopyInto(out *PodSetReplicas) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetReplicas.
+func (in *PodSetReplicas) DeepCopy() *PodSetReplicas {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetReplicas)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSetStatusInfo) DeepCopyInto(out *PodSetStatusInfo) {
 	*out = *in
@@ -690,6 +845,21 @@ func (in *PodSetStatusInfo) DeepCopy() *PodSetStatusInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSetValues) DeepCopyInto(out *PodSetValues) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSetValues.
+func (in *PodSetValues) DeepCopy() *PodSetValues {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSetValues)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSpec) DeepCopyInto(out *PodSpec) {
 	*out = *in
@@ -720,6 +890,21 @@ func (in *PodSpec) DeepCopy() *PodSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceKeySelector) DeepCopyInto(out *ResourceKeySelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceKeySelector.
+func (in *ResourceKeySelector) DeepCopy() *ResourceKeySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceKeySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Service) DeepCopyInto(out *Service) {
 	*out = *in
@@ -44,6 +44,14 @@ func ControllerCmd() *cobra.Command {
 	// Advdeployment config
 	controllerCmd.PersistentFlags().Int32Var(&opt.AdvConfig.RevisionHistoryLimit, "revision-limit", opt.AdvConfig.RevisionHistoryLimit, "revision history limit")
 	controllerCmd.PersistentFlags().Int32Var(&opt.AdvConfig.ProgressDeadlineSeconds, "progress-deadline-seconds", opt.AdvConfig.ProgressDeadlineSeconds, "progress-deadline-seconds")
+	controllerCmd.PersistentFlags().StringVar(&opt.AdvConfig.Chart.CacheDir, "chart-cache-dir", opt.AdvConfig.Chart.CacheDir, "directory charts fetched with chart url are cached in")
+	controllerCmd.PersistentFlags().DurationVar(&opt.AdvConfig.Chart.IndexTTL, "chart-index-ttl", opt.AdvConfig.Chart.IndexTTL, "chart repository index, chart package url and OCI tag cache ttl")
+	controllerCmd.PersistentFlags().DurationVar(&opt.AdvConfig.Chart.ChartTTL, "chart-cache-ttl", opt.AdvConfig.Chart.ChartTTL, "cached chart is removed if not used in ttl")
+	controllerCmd.PersistentFlags().Int64Var(&opt.AdvConfig.Chart.MaxCacheSize, "chart-cache-max-size", opt.AdvConfig.Chart.MaxCacheSize, "max bytes of cached charts, 0 means no limit")
+	controllerCmd.PersistentFlags().DurationVar(&opt.AdvConfig.Chart.Timeout, "chart-fetch-timeout", opt.AdvConfig.Chart.Timeout, "chart fetch http request timeout")
+	controllerCmd.PersistentFlags().DurationVar(&opt.AdvConfig.CapabilitiesTTL, "capabilities-ttl", opt.AdvConfig.CapabilitiesTTL, "cluster capabilities used for rendering charts are discovered again after ttl")
+	controllerCmd.PersistentFlags().BoolVar(&opt.AdvConfig.LookupAllNamespaces, "lookup-all-namespaces", opt.AdvConfig.LookupAllNamespaces, "allow chart lookup function to read all namespaces, default is limited to the namespace of advdeployment")
+	controllerCmd.PersistentFlags().IntVar(&opt.AdvConfig.RenderCacheSize, "render-cache-size", opt.AdvConfig.RenderCacheSize, "max number of podSet render results cached, 0 means disabled")
 
 	// namespace filter
 	controllerCmd.PersistentFlags().StringArrayVar(&types.FilterNamespaceAppset, "filter-namespace-master", types.FilterNamespaceAppset, "master watch resource filter namespace")
@@ -23,6 +23,7 @@ func GetRootCmd() *cobra.Command {
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
 
 	rootCmd.AddCommand(ControllerCmd())
+	rootCmd.AddCommand(WebhookCmd())
 	rootCmd.AddCommand(VersionCmd())
 
 	return rootCmd
@@ -0,0 +1,43 @@
+package ops
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/symcn/sym-ops/pkg/webhook"
+)
+
+// WebhookCmd webhook component
+func WebhookCmd() *cobra.Command {
+	opt := webhook.DefaultOptions()
+	webhookCmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Start admission webhook component for AppSet and AdvDeployment.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			PrintFlags(cmd.Flags())
+
+			srv, err := webhook.NewServer(opt)
+			if err != nil {
+				return err
+			}
+			return srv.Start()
+		},
+	}
+
+	// Webhook server config
+	webhookCmd.PersistentFlags().IntVar(&opt.Port, "port", opt.Port, "webhook server listener port")
+	webhookCmd.PersistentFlags().StringVar(&opt.CertDir, "cert-dir", opt.CertDir, "directory the serving certificate is written to")
+	webhookCmd.PersistentFlags().StringVar(&opt.ServiceName, "service-name", opt.ServiceName, "webhook service name, the serving certificate is issued for it")
+	webhookCmd.PersistentFlags().StringVar(&opt.ServiceNamespace, "service-namespace", opt.ServiceNamespace, "webhook service namespace")
+	webhookCmd.PersistentFlags().StringVar(&opt.SecretName, "secret-name", opt.SecretName, "secret in service namespace which stores the certificate")
+	webhookCmd.PersistentFlags().StringVar(&opt.MutatingWebhookConfigurationName, "mutating-config", opt.MutatingWebhookConfigurationName, "MutatingWebhookConfiguration name to patch caBundle, empty means skip")
+	webhookCmd.PersistentFlags().StringVar(&opt.ValidatingWebhookConfigurationName, "validating-config", opt.ValidatingWebhookConfigurationName, "ValidatingWebhookConfiguration name to patch caBundle, empty means skip")
+	webhookCmd.PersistentFlags().DurationVar(&opt.CertValidity, "cert-validity", opt.CertValidity, "serving certificate validity")
+	webhookCmd.PersistentFlags().DurationVar(&opt.CertRotateBefore, "cert-rotate-before", opt.CertRotateBefore, "rotate serving certificate when the remaining validity is less than it")
+	webhookCmd.PersistentFlags().DurationVar(&opt.CertCheckInterval, "cert-check-interval", opt.CertCheckInterval, "interval of checking serving certificate and caBundle")
+
+	// ClusterManagerOptions config
+	webhookCmd.PersistentFlags().IntVar(&opt.ClusterManagerOptions.QPS, "qps", opt.ClusterManagerOptions.QPS, "maximum QPS to the master from this client")
+	webhookCmd.PersistentFlags().IntVar(&opt.ClusterManagerOptions.Burst, "burst", opt.ClusterManagerOptions.Burst, "maximum burst for throttle")
+
+	return webhookCmd
+}
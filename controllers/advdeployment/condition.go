@@ -0,0 +1,96 @@
+package advdeployment
+
+import (
+	"fmt"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	reasonValuesSchemaInvalid = "ValuesSchemaInvalid"
+	reasonReconciled          = "Reconciled"
+)
+
+// getAdvDeploymentCondition returns the condition with the provided type
+func getAdvDeploymentCondition(status *workloadv1beta1.AdvDeploymentStatus, condType workloadv1beta1.AdvDeploymentConditionType) *workloadv1beta1.AdvDeploymentCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setAdvDeploymentCondition updates status with the provided condition, the last transition time
+// is kept if the status is not changed. It returns false when nothing changed.
+func setAdvDeploymentCondition(status *workloadv1beta1.AdvDeploymentStatus, cond workloadv1beta1.AdvDeploymentCondition) bool {
+	current := getAdvDeploymentCondition(status, cond.Type)
+	if current == nil {
+		status.Conditions = append(status.Conditions, cond)
+		return true
+	}
+	if current.Status == cond.Status && current.Reason == cond.Reason && current.Message == cond.Message {
+		return false
+	}
+	if current.Status == cond.Status {
+		cond.LastTransitionTime = current.LastTransitionTime
+	}
+	*current = cond
+	return true
+}
+
+func newAdvDeploymentCondition(condType workloadv1beta1.AdvDeploymentConditionType, status corev1.ConditionStatus, reason, message string) workloadv1beta1.AdvDeploymentCondition {
+	now := metav1.Now()
+	return workloadv1beta1.AdvDeploymentCondition{
+		Type:               condType,
+		Status:             status,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// reconciledCondition returns the ReconcileFailed condition turned to false, nil if it is not
+// failed before.
+func reconciledCondition(status *workloadv1beta1.AdvDeploymentStatus) *workloadv1beta1.AdvDeploymentCondition {
+	current := getAdvDeploymentCondition(status, workloadv1beta1.DeploymentReconcileFailed)
+	if current == nil || current.Status == corev1.ConditionFalse {
+		return nil
+	}
+	cond := newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionFalse, reasonReconciled, "")
+	return &cond
+}
+
+// schemaErrorMessage lists every failing path of podSet values
+func schemaErrorMessage(podSetName string, err *helm.SchemaError) string {
+	return fmt.Sprintf("podSet %s %s", podSetName, err.Error())
+}
+
+// reportSchemaError records the ReconcileFailed condition and an event when podSet values don't
+// meet the chart schema.
+func (w *worker) reportSchemaError(req ktypes.NamespacedName, adv *workloadv1beta1.AdvDeployment, podSetName string, schemaErr *helm.SchemaError) {
+	message := schemaErrorMessage(podSetName, schemaErr)
+	w.currentCli.Eventf(adv, corev1.EventTypeWarning, reasonValuesSchemaInvalid, "%s", message)
+
+	cond := newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionTrue, reasonValuesSchemaInvalid, message)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := &workloadv1beta1.AdvDeployment{}
+		if err := w.currentCli.Get(req, obj); err != nil {
+			return err
+		}
+		if !setAdvDeploymentCondition(&obj.Status, cond) {
+			return nil
+		}
+		return w.currentCli.StatusUpdate(obj)
+	})
+	if err != nil {
+		klog.Errorf("Update advdeployment %s condition %s failed: %v", req, workloadv1beta1.DeploymentReconcileFailed, err)
+	}
+}
@@ -0,0 +1,96 @@
+package advdeployment
+
+import (
+	"testing"
+	"time"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetAdvDeploymentCondition(t *testing.T) {
+	before := metav1.NewTime(time.Now().Add(-time.Hour))
+	failed := workloadv1beta1.AdvDeploymentCondition{
+		Type:               workloadv1beta1.DeploymentReconcileFailed,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: before,
+		Reason:             reasonValuesSchemaInvalid,
+		Message:            "podSet blue values don't meet the chart schema: image.tag: Invalid type",
+	}
+
+	args := []struct {
+		name             string
+		conditions       []workloadv1beta1.AdvDeploymentCondition
+		cond             workloadv1beta1.AdvDeploymentCondition
+		expectChanged    bool
+		expectTransition bool
+	}{
+		{
+			name:             "add",
+			cond:             newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionTrue, reasonValuesSchemaInvalid, failed.Message),
+			expectChanged:    true,
+			expectTransition: true,
+		},
+		{
+			name:          "same",
+			conditions:    []workloadv1beta1.AdvDeploymentCondition{failed},
+			cond:          newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionTrue, reasonValuesSchemaInvalid, failed.Message),
+			expectChanged: false,
+		},
+		{
+			name:             "message changed",
+			conditions:       []workloadv1beta1.AdvDeploymentCondition{failed},
+			cond:             newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionTrue, reasonValuesSchemaInvalid, "podSet blue values don't meet the chart schema: (root): image is required"),
+			expectChanged:    true,
+			expectTransition: false,
+		},
+		{
+			name:             "status changed",
+			conditions:       []workloadv1beta1.AdvDeploymentCondition{failed},
+			cond:             newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionFalse, reasonReconciled, ""),
+			expectChanged:    true,
+			expectTransition: true,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			status := &workloadv1beta1.AdvDeploymentStatus{Conditions: arg.conditions}
+			if changed := setAdvDeploymentCondition(status, arg.cond); changed != arg.expectChanged {
+				t.Fatalf("expect changed %v, but got %v", arg.expectChanged, changed)
+			}
+			if len(status.Conditions) != 1 {
+				t.Fatalf("expect 1 condition, but got %d", len(status.Conditions))
+			}
+			if !arg.expectChanged {
+				return
+			}
+			cond := status.Conditions[0]
+			if cond.Status != arg.cond.Status || cond.Message != arg.cond.Message {
+				t.Errorf("expect condition %v, but got %v", arg.cond, cond)
+			}
+			if transitioned := !cond.LastTransitionTime.Equal(&before); transitioned != arg.expectTransition {
+				t.Errorf("expect transition %v, but got %v", arg.expectTransition, transitioned)
+			}
+		})
+	}
+}
+
+func TestReconciledCondition(t *testing.T) {
+	status := &workloadv1beta1.AdvDeploymentStatus{}
+	if cond := reconciledCondition(status); cond != nil {
+		t.Errorf("expect nil without failure, but got %v", cond)
+	}
+
+	setAdvDeploymentCondition(status, newAdvDeploymentCondition(workloadv1beta1.DeploymentReconcileFailed, corev1.ConditionTrue, reasonValuesSchemaInvalid, "invalid"))
+	cond := reconciledCondition(status)
+	if cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != reasonReconciled {
+		t.Fatalf("expect reconciled condition, but got %v", cond)
+	}
+
+	setAdvDeploymentCondition(status, *cond)
+	if cond = reconciledCondition(status); cond != nil {
+		t.Errorf("expect nil after reconciled, but got %v", cond)
+	}
+}
@@ -1,6 +1,9 @@
 package advdeployment
 
 import (
+	"time"
+
+	"github.com/symcn/sym-ops/pkg/helm"
 	"k8s.io/api/autoscaling/v2beta2"
 	v1 "k8s.io/api/core/v1"
 )
@@ -13,6 +16,16 @@ type AdvConfig struct {
 
 	MetricCPUValue *int32
 	MetricMemValue *int32
+
+	// Chart is the options of fetching chart with chart url
+	Chart *helm.FetcherOptions
+	// CapabilitiesTTL is how long the discovered cluster Capabilities is reused for rendering
+	CapabilitiesTTL time.Duration
+	// LookupAllNamespaces allows the chart lookup function to read all namespaces, it is
+	// limited to the namespace of AdvDeployment by default
+	LookupAllNamespaces bool
+	// RenderCacheSize is the max number of podSet render results cached, 0 means disabled
+	RenderCacheSize int
 }
 
 var (
@@ -20,6 +33,8 @@ var (
 	defaultProgressDeadlineSeconds int32 = 600
 	defaultMetricCPUValue          int32 = 70
 	defaultMetricMemValue          int32 = 70
+	defaultCapabilitiesTTL               = time.Minute * 10
+	defaultRenderCacheSize               = 1024
 )
 
 // DefaultAdvConfig returns default AdvConfig
@@ -30,6 +45,9 @@ func DefaultAdvConfig() *AdvConfig {
 		Debug:                   false,
 		MetricCPUValue:          &defaultMetricCPUValue,
 		MetricMemValue:          &defaultMetricMemValue,
+		Chart:                   helm.DefaultFetcherOptions(),
+		CapabilitiesTTL:         defaultCapabilitiesTTL,
+		RenderCacheSize:         defaultRenderCacheSize,
 	}
 }
 
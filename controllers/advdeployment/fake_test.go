@@ -0,0 +1,99 @@
+package advdeployment
+
+import (
+	"context"
+
+	"github.com/symcn/api"
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+func init() {
+	clientgoscheme.AddToScheme(types.Scheme)
+	workloadv1beta1.AddToScheme(types.Scheme)
+}
+
+// fakeMingleClient is the MingleClient of a fake cluster, the methods not overridden panic
+type fakeMingleClient struct {
+	api.MingleClient
+	cli     rtclient.Client
+	kubeCli kubernetes.Interface
+}
+
+type fakeClusterCfgInfo struct {
+	api.ClusterCfgInfo
+	name string
+}
+
+func (f *fakeClusterCfgInfo) GetName() string { return f.name }
+
+// fakeManager serves the scheme and RESTMapper of fake cluster
+type fakeManager struct {
+	manager.Manager
+}
+
+func (m *fakeManager) GetScheme() *runtime.Scheme { return types.Scheme }
+
+func (m *fakeManager) GetRESTMapper() meta.RESTMapper {
+	return testrestmapper.TestOnlyStaticRESTMapper(types.Scheme)
+}
+
+func newFakeMingleClient(objs ...rtclient.Object) *fakeMingleClient {
+	return &fakeMingleClient{
+		cli:     fake.NewClientBuilder().WithScheme(types.Scheme).WithObjects(objs...).Build(),
+		kubeCli: kubefake.NewSimpleClientset(),
+	}
+}
+
+func (f *fakeMingleClient) GetClusterCfgInfo() api.ClusterCfgInfo {
+	return &fakeClusterCfgInfo{name: "cluster-a"}
+}
+
+func (f *fakeMingleClient) GetKubeInterface() kubernetes.Interface {
+	return f.kubeCli
+}
+
+func (f *fakeMingleClient) GetCtrlRtManager() manager.Manager {
+	return &fakeManager{}
+}
+
+func (f *fakeMingleClient) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+func (f *fakeMingleClient) Get(key ktypes.NamespacedName, obj rtclient.Object) error {
+	return f.cli.Get(context.TODO(), key, obj)
+}
+
+func (f *fakeMingleClient) Create(obj rtclient.Object, opts ...rtclient.CreateOption) error {
+	return f.cli.Create(context.TODO(), obj, opts...)
+}
+
+func (f *fakeMingleClient) Delete(obj rtclient.Object, opts ...rtclient.DeleteOption) error {
+	return f.cli.Delete(context.TODO(), obj, opts...)
+}
+
+func (f *fakeMingleClient) Update(obj rtclient.Object, opts ...rtclient.UpdateOption) error {
+	return f.cli.Update(context.TODO(), obj, opts...)
+}
+
+func (f *fakeMingleClient) StatusUpdate(obj rtclient.Object, opts ...rtclient.UpdateOption) error {
+	return f.cli.Status().Update(context.TODO(), obj, opts...)
+}
+
+func (f *fakeMingleClient) Patch(obj rtclient.Object, patch rtclient.Patch, opts ...rtclient.PatchOption) error {
+	return f.cli.Patch(context.TODO(), obj, patch, opts...)
+}
+
+func (f *fakeMingleClient) List(obj rtclient.ObjectList, opts ...rtclient.ListOption) error {
+	return f.cli.List(context.TODO(), obj, opts...)
+}
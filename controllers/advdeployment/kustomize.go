@@ -0,0 +1,98 @@
+package advdeployment
+
+import (
+	"fmt"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	"github.com/symcn/sym-ops/pkg/kustomize"
+	"github.com/symcn/sym-ops/pkg/types"
+	kstypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+// renderKustomizeObjects build the kustomization of every podSet with the podSet overlay, the
+// podSet name suffix keeps the objects of podSets apart, the same as helm release name does.
+func (w *worker) renderKustomizeObjects(adv *workloadv1beta1.AdvDeployment) ([]podSetObject, error) {
+	var objects []podSetObject
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		if podSet == nil {
+			continue
+		}
+		tarball, err := w.getChart(podSet, adv)
+		if err != nil {
+			return nil, err
+		}
+		if len(tarball) == 0 {
+			return nil, fmt.Errorf("PodSet %s kustomize tarball is empty", podSet.Name)
+		}
+		objs, err := kustomize.Render(tarball, getKustomizePath(podSet, adv), podSetOverlay(adv, podSet))
+		if err != nil {
+			return nil, fmt.Errorf("PodSet %s render kustomization failed: %v", podSet.Name, err)
+		}
+		helm.AddTrackingLabels(objs, w.trackingLabels(adv, podSet))
+		for _, obj := range objs {
+			objects = append(objects, podSetObject{podSet: podSet, obj: obj})
+		}
+	}
+	return objects, nil
+}
+
+// podSetOverlay the podSet label is added to selectors too, so the workloads of podSets never
+// select the pods of each other.
+func podSetOverlay(adv *workloadv1beta1.AdvDeployment, podSet *workloadv1beta1.PodSet) *kustomize.Overlay {
+	overlay := &kustomize.Overlay{
+		Name:         podSet.Name,
+		Namespace:    adv.Namespace,
+		NameSuffix:   "-" + podSet.Name,
+		CommonLabels: map[string]string{types.LabelKeyPodSetName: podSet.Name},
+	}
+
+	custom := getKustomizeOverlay(podSet, adv)
+	if custom == nil {
+		return overlay
+	}
+	for _, p := range custom.Patches {
+		patch := kstypes.Patch{Patch: p.Patch}
+		if p.Target != nil {
+			patch.Target = &kstypes.Selector{
+				ResId: resid.ResId{
+					Gvk:  resid.Gvk{Group: p.Target.Group, Version: p.Target.Version, Kind: p.Target.Kind},
+					Name: p.Target.Name,
+				},
+				LabelSelector:      p.Target.LabelSelector,
+				AnnotationSelector: p.Target.AnnotationSelector,
+			}
+		}
+		overlay.Patches = append(overlay.Patches, patch)
+	}
+	for _, image := range custom.Images {
+		overlay.Images = append(overlay.Images, kstypes.Image{Name: image.Name, NewName: image.NewName, NewTag: image.NewTag, Digest: image.Digest})
+	}
+	for _, replica := range custom.Replicas {
+		overlay.Replicas = append(overlay.Replicas, kstypes.Replica{Name: replica.Name, Count: replica.Count})
+	}
+	return overlay
+}
+
+// getKustomizeOverlay returns the podSet kustomize overlay, the global one is used if it is nil
+func getKustomizeOverlay(podSet *workloadv1beta1.PodSet, adv *workloadv1beta1.AdvDeployment) *workloadv1beta1.KustomizeOverlay {
+	if podSet.Chart != nil && podSet.Chart.Kustomize != nil {
+		return podSet.Chart.Kustomize
+	}
+	if adv.Spec.PodSpec.Chart != nil {
+		return adv.Spec.PodSpec.Chart.Kustomize
+	}
+	return nil
+}
+
+// getKustomizePath returns the podSet kustomize path, the global one is used if it is empty
+func getKustomizePath(podSet *workloadv1beta1.PodSet, adv *workloadv1beta1.AdvDeployment) string {
+	if podSet.Chart != nil && podSet.Chart.KustomizePath != "" {
+		return podSet.Chart.KustomizePath
+	}
+	if adv.Spec.PodSpec.Chart != nil {
+		return adv.Spec.PodSpec.Chart.KustomizePath
+	}
+	return ""
+}
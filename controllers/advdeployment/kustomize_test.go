@@ -0,0 +1,85 @@
+package advdeployment
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/kustomize"
+	"github.com/symcn/sym-ops/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kstypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+func TestPodSetOverlay(t *testing.T) {
+	adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	adv.Spec.PodSpec.Chart = &workloadv1beta1.ChartSpec{
+		KustomizePath: "overlays/rz",
+		Kustomize: &workloadv1beta1.KustomizeOverlay{
+			Images: []workloadv1beta1.KustomizeImage{{Name: "nginx", NewTag: "1.20"}},
+		},
+	}
+
+	args := []struct {
+		name         string
+		podSet       *workloadv1beta1.PodSet
+		expectPath   string
+		expectSuffix string
+		expectCustom kustomize.Overlay
+	}{
+		{
+			name:         "global path",
+			podSet:       &workloadv1beta1.PodSet{Name: "blue"},
+			expectPath:   "overlays/rz",
+			expectSuffix: "-blue",
+			expectCustom: kustomize.Overlay{Images: []kstypes.Image{{Name: "nginx", NewTag: "1.20"}}},
+		},
+		{
+			name:         "podSet path",
+			podSet:       &workloadv1beta1.PodSet{Name: "green", Chart: &workloadv1beta1.ChartSpec{KustomizePath: "overlays/gz"}},
+			expectPath:   "overlays/gz",
+			expectSuffix: "-green",
+			expectCustom: kustomize.Overlay{Images: []kstypes.Image{{Name: "nginx", NewTag: "1.20"}}},
+		},
+		{
+			name: "podSet overlay",
+			podSet: &workloadv1beta1.PodSet{Name: "red", Chart: &workloadv1beta1.ChartSpec{Kustomize: &workloadv1beta1.KustomizeOverlay{
+				Patches: []workloadv1beta1.KustomizePatch{
+					{Patch: "patch", Target: &workloadv1beta1.KustomizeSelector{Kind: "Deployment", Name: "app", LabelSelector: "app=app"}},
+				},
+				Images:   []workloadv1beta1.KustomizeImage{{Name: "nginx", NewName: "mirror/nginx", NewTag: "1.21"}},
+				Replicas: []workloadv1beta1.KustomizeReplica{{Name: "app", Count: 2}},
+			}}},
+			expectPath:   "overlays/rz",
+			expectSuffix: "-red",
+			expectCustom: kustomize.Overlay{
+				Patches: []kstypes.Patch{
+					{Patch: "patch", Target: &kstypes.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: "Deployment"}, Name: "app"}, LabelSelector: "app=app"}},
+				},
+				Images:   []kstypes.Image{{Name: "nginx", NewName: "mirror/nginx", NewTag: "1.21"}},
+				Replicas: []kstypes.Replica{{Name: "app", Count: 2}},
+			},
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			if got := getKustomizePath(arg.podSet, adv); got != arg.expectPath {
+				t.Errorf("expect path %s, but got %s", arg.expectPath, got)
+			}
+			expect := &kustomize.Overlay{
+				Name:         arg.podSet.Name,
+				Namespace:    "default",
+				NameSuffix:   arg.expectSuffix,
+				CommonLabels: map[string]string{types.LabelKeyPodSetName: arg.podSet.Name},
+				Patches:      arg.expectCustom.Patches,
+				Images:       arg.expectCustom.Images,
+				Replicas:     arg.expectCustom.Replicas,
+			}
+			if got := podSetOverlay(adv, arg.podSet); !reflect.DeepEqual(got, expect) {
+				t.Errorf("expect overlay %v, but got %v", expect, got)
+			}
+		})
+	}
+}
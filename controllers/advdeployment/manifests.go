@@ -0,0 +1,73 @@
+package advdeployment
+
+import (
+	"fmt"
+	"regexp"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	"github.com/symcn/sym-ops/pkg/utils"
+)
+
+var manifestsVarRegexp = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// buildManifestsObjects parse the YAML bundle for every podSet with its meta substituted. The
+// same object must not come from more than one podSet, so names of the workloads shared by
+// podSets should contain a meta var, such as app-${color}.
+func (w *worker) buildManifestsObjects(adv *workloadv1beta1.AdvDeployment) ([]podSetObject, error) {
+	var objects []podSetObject
+	owners := map[string]string{}
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		if podSet == nil {
+			continue
+		}
+		bundle, err := w.getManifests(podSet, adv)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := helm.ParseYAML2K8sObjects([]byte(expandManifestsVars(bundle, podSet.Mata)))
+		if err != nil {
+			return nil, fmt.Errorf("PodSet %s parse manifests failed: %v", podSet.Name, err)
+		}
+		helm.AddTrackingLabels(objs, w.trackingLabels(adv, podSet))
+		for _, obj := range objs {
+			key := obj.GroupKind().String() + "/" + obj.GetName()
+			if owner, ok := owners[key]; ok {
+				return nil, fmt.Errorf("%s %s is in the manifests of both PodSet %s and %s", obj.GroupKind().Kind, obj.GetName(), owner, podSet.Name)
+			}
+			owners[key] = podSet.Name
+			objects = append(objects, podSetObject{podSet: podSet, obj: obj})
+		}
+	}
+	return objects, nil
+}
+
+// getManifests returns the YAML bundle of podSet, rawManifests takes precedence over chartFrom
+func (w *worker) getManifests(podSet *workloadv1beta1.PodSet, adv *workloadv1beta1.AdvDeployment) (string, error) {
+	chart := getChartSpec(podSet, adv)
+	if chart == nil {
+		return "", fmt.Errorf("PodSet %s manifests is nil", podSet.Name)
+	}
+	if chart.RawManifests != "" {
+		return chart.RawManifests, nil
+	}
+	if chart.ChartFrom == nil {
+		return "", fmt.Errorf("PodSet %s raw manifests and chart from are both nil", podSet.Name)
+	}
+	data, err := utils.GetReferencedData(w.currentCli.GetKubeInterface(), adv.Namespace, chart.ChartFrom, utils.DefaultManifestsKey)
+	if err != nil {
+		return "", fmt.Errorf("PodSet %s get manifests failed: %v", podSet.Name, err)
+	}
+	return string(data), nil
+}
+
+// expandManifestsVars replace ${key} with the value of key in meta, the vars not in meta are
+// kept as they are, such as the ones in shell scripts of ConfigMaps.
+func expandManifestsVars(bundle string, meta map[string]string) string {
+	return manifestsVarRegexp.ReplaceAllStringFunc(bundle, func(s string) string {
+		if v, ok := meta[s[2:len(s)-1]]; ok {
+			return v
+		}
+		return s
+	})
+}
@@ -0,0 +1,243 @@
+package advdeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	symctx "github.com/symcn/sym-ops/pkg/context"
+	"github.com/symcn/sym-ops/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestExpandManifestsVars(t *testing.T) {
+	meta := map[string]string{"color": "blue", "zone.name": "rz"}
+	args := []struct {
+		name   string
+		bundle string
+		expect string
+	}{
+		{
+			name:   "replace",
+			bundle: "name: app-${color}\nzone: ${zone.name}\n",
+			expect: "name: app-blue\nzone: rz\n",
+		},
+		{
+			name:   "not in meta",
+			bundle: "command: echo ${HOME} $color ${color}\n",
+			expect: "command: echo ${HOME} $color blue\n",
+		},
+		{
+			name:   "no vars",
+			bundle: "name: app\n",
+			expect: "name: app\n",
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			if got := expandManifestsVars(arg.bundle, meta); got != arg.expect {
+				t.Errorf("expect %q, but got %q", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestGetManifests(t *testing.T) {
+	adv := &workloadv1beta1.AdvDeployment{}
+	adv.Spec.PodSpec = workloadv1beta1.PodSpec{
+		DeployType: workloadv1beta1.DeployTypeManifests,
+		Chart:      &workloadv1beta1.ChartSpec{RawManifests: "global"},
+	}
+	w := &worker{}
+
+	args := []struct {
+		name   string
+		podSet *workloadv1beta1.PodSet
+		expect string
+	}{
+		{
+			name:   "global",
+			podSet: &workloadv1beta1.PodSet{Name: "blue"},
+			expect: "global",
+		},
+		{
+			name:   "podSet override",
+			podSet: &workloadv1beta1.PodSet{Name: "green", Chart: &workloadv1beta1.ChartSpec{RawManifests: "green"}},
+			expect: "green",
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			got, err := w.getManifests(arg.podSet, adv)
+			if err != nil {
+				t.Fatalf("get manifests failed: %v", err)
+			}
+			if got != arg.expect {
+				t.Errorf("expect %q, but got %q", arg.expect, got)
+			}
+		})
+	}
+}
+
+const testManifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-${color}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-${color}
+spec:
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: nginx
+`
+
+func newManifestsAdvDeployment(manifests string, podSets ...*workloadv1beta1.PodSet) *workloadv1beta1.AdvDeployment {
+	adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	adv.Spec.PodSpec.DeployType = workloadv1beta1.DeployTypeManifests
+	adv.Spec.PodSpec.Chart = &workloadv1beta1.ChartSpec{RawManifests: manifests}
+	adv.Spec.Topology.PodSets = podSets
+	return adv
+}
+
+func TestBuildManifestsObjectsDuplicated(t *testing.T) {
+	args := []struct {
+		name    string
+		podSets []*workloadv1beta1.PodSet
+		expect  int
+		wantErr bool
+	}{
+		{
+			name: "named with meta",
+			podSets: []*workloadv1beta1.PodSet{
+				{Name: "blue", Mata: map[string]string{"color": "blue"}},
+				{Name: "green", Mata: map[string]string{"color": "green"}},
+			},
+			expect: 4,
+		},
+		{
+			name: "same name in podSets",
+			podSets: []*workloadv1beta1.PodSet{
+				{Name: "blue", Mata: map[string]string{"color": "blue"}},
+				{Name: "green", Mata: map[string]string{"color": "blue"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			w := &worker{currentCli: newFakeMingleClient()}
+			objects, err := w.buildManifestsObjects(newManifestsAdvDeployment(testManifests, arg.podSets...))
+			if (err != nil) != arg.wantErr {
+				t.Fatalf("expect error %v, but got %v", arg.wantErr, err)
+			}
+			if len(objects) != arg.expect {
+				t.Errorf("expect %d objects, but got %d", arg.expect, len(objects))
+			}
+		})
+	}
+}
+
+func TestStepApplyResourcesDefaultNamespace(t *testing.T) {
+	cli := newFakeMingleClient()
+	w := &worker{currentCli: cli, conf: DefaultAdvConfig()}
+	adv := newManifestsAdvDeployment(testManifests, &workloadv1beta1.PodSet{Name: "blue", Mata: map[string]string{"color": "blue"}})
+	ctx := symctx.WithValue(context.TODO(), types.ContextKeyStepStop, false)
+
+	if err := w.stepApplyResources(ctx, ktypes.NamespacedName{Name: "app", Namespace: "default"}, adv); err != nil {
+		t.Fatalf("apply resources failed: %v", err)
+	}
+	for _, obj := range []rtclient.Object{&corev1.ConfigMap{}, &appsv1.Deployment{}} {
+		if err := cli.Get(ktypes.NamespacedName{Name: "app-blue", Namespace: "default"}, obj); err != nil {
+			t.Errorf("expect %T created in the AdvDeployment namespace, but got %v", obj, err)
+		}
+	}
+	expect := []string{"ConfigMap:default/app-blue", "Deployment.apps:default/app-blue"}
+	if owners, _ := symctx.GetValue(ctx, types.ContextKeyAdvdeploymentOwnerRes).([]string); !reflect.DeepEqual(owners, expect) {
+		t.Errorf("expect owner resources %v, but got %v", expect, owners)
+	}
+}
+
+func TestStepApplyResourcesSkipHooks(t *testing.T) {
+	manifests := testManifests + `---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app-${color}-test
+  annotations:
+    helm.sh/hook: test
+spec:
+  containers:
+  - name: test
+    image: busybox
+`
+	cli := newFakeMingleClient()
+	w := &worker{currentCli: cli, conf: DefaultAdvConfig()}
+	adv := newManifestsAdvDeployment(manifests, &workloadv1beta1.PodSet{Name: "blue", Mata: map[string]string{"color": "blue"}})
+	ctx := symctx.WithValue(context.TODO(), types.ContextKeyStepStop, false)
+
+	if err := w.stepApplyResources(ctx, ktypes.NamespacedName{Name: "app", Namespace: "default"}, adv); err != nil {
+		t.Fatalf("apply resources failed: %v", err)
+	}
+	err := cli.Get(ktypes.NamespacedName{Name: "app-blue-test", Namespace: "default"}, &corev1.Pod{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expect hook pod not applied, but got %v", err)
+	}
+	expect := []string{"ConfigMap:default/app-blue", "Deployment.apps:default/app-blue"}
+	if owners, _ := symctx.GetValue(ctx, types.ContextKeyAdvdeploymentOwnerRes).([]string); !reflect.DeepEqual(owners, expect) {
+		t.Errorf("expect owner resources %v, but got %v", expect, owners)
+	}
+}
+
+func TestCheckServiceOwnerRendered(t *testing.T) {
+	manifests := testManifests + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app-${color}
+  labels:
+    app: nginx
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+`
+	cli := newFakeMingleClient()
+	w := &worker{currentCli: cli, conf: DefaultAdvConfig()}
+	adv := newManifestsAdvDeployment(manifests, &workloadv1beta1.PodSet{Name: "blue", Mata: map[string]string{"color": "blue"}})
+	adv.UID = "adv-uid"
+	ctx := symctx.WithValue(context.TODO(), types.ContextKeyStepStop, false)
+
+	if err := w.stepApplyResources(ctx, ktypes.NamespacedName{Name: "app", Namespace: "default"}, adv); err != nil {
+		t.Fatalf("apply resources failed: %v", err)
+	}
+	w.checkServiceOwner(adv)
+
+	svc := &corev1.Service{}
+	if err := cli.Get(ktypes.NamespacedName{Name: "app-blue", Namespace: "default"}, svc); err != nil {
+		t.Fatalf("get service failed: %v", err)
+	}
+	if !metav1.IsControlledBy(svc, adv) {
+		t.Errorf("expect service controlled by AdvDeployment, but got owners %v", svc.OwnerReferences)
+	}
+}
@@ -0,0 +1,138 @@
+package advdeployment
+
+import (
+	"fmt"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	"github.com/symcn/sym-ops/pkg/types"
+	"github.com/symcn/sym-ops/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// buildWorkloadObjects build one Deployment or StatefulSet per podSet from the podSpec selector
+// and template without chart. The podSet image, version and node selector are applied when
+// reconciling, the same as the rendered workloads.
+func (w *worker) buildWorkloadObjects(adv *workloadv1beta1.AdvDeployment) ([]podSetObject, error) {
+	var objects []podSetObject
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		if podSet == nil {
+			continue
+		}
+		obj, err := buildPodSetWorkload(adv, podSet)
+		if err != nil {
+			return nil, err
+		}
+		helm.AddTrackingLabels([]helm.K8sObject{obj}, w.trackingLabels(adv, podSet))
+		objects = append(objects, podSetObject{podSet: podSet, obj: obj})
+	}
+
+	if adv.Spec.PodSpec.GetDeployType() == workloadv1beta1.DeployTypeStatefulSet && adv.Spec.ServiceName == nil {
+		svc, err := buildHeadlessService(adv)
+		if err != nil {
+			return nil, err
+		}
+		// shared by all podSets, so it has no podSet label
+		svcLabels := w.trackingLabels(adv, &workloadv1beta1.PodSet{})
+		delete(svcLabels, types.LabelKeyPodSetName)
+		helm.AddTrackingLabels([]helm.K8sObject{svc}, svcLabels)
+		objects = append(objects, podSetObject{obj: svc})
+	}
+	return objects, nil
+}
+
+// statefulSetServiceName the governing Service of StatefulSets, spec serviceName is used if it is
+// set, otherwise the headless Service built by buildHeadlessService.
+func statefulSetServiceName(adv *workloadv1beta1.AdvDeployment) string {
+	if adv.Spec.ServiceName != nil && *adv.Spec.ServiceName != "" {
+		return *adv.Spec.ServiceName
+	}
+	return adv.Name + types.ServiceNameSuffix
+}
+
+// buildHeadlessService build the headless Service selecting the pods of all podSets, it gives the
+// StatefulSet pods stable network identities.
+func buildHeadlessService(adv *workloadv1beta1.AdvDeployment) (helm.K8sObject, error) {
+	podSpec := &adv.Spec.PodSpec
+	if podSpec.Selector == nil || len(podSpec.Selector.MatchLabels) == 0 {
+		return nil, fmt.Errorf("selector matchLabels is required to build the headless Service, or set serviceName")
+	}
+	svc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: types.ServiceKind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      statefulSetServiceName(adv),
+			Namespace: adv.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 podSpec.Selector.MatchLabels,
+			PublishNotReadyAddresses: true,
+		},
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(svc)
+	if err != nil {
+		return nil, fmt.Errorf("convert headless Service to unstructured failed: %v", err)
+	}
+	return helm.NewK8sObject(&unstructured.Unstructured{Object: u}, nil, nil), nil
+}
+
+// buildPodSetWorkload build the podSet workload named as the podSet, as the helm release name is.
+// The podSet label is added to the selector and template, so the workloads of podSets never
+// select the pods of each other.
+func buildPodSetWorkload(adv *workloadv1beta1.AdvDeployment, podSet *workloadv1beta1.PodSet) (helm.K8sObject, error) {
+	podSpec := &adv.Spec.PodSpec
+	if podSpec.Selector == nil || podSpec.Template == nil {
+		return nil, fmt.Errorf("selector and template are required when deployType is %s", podSpec.GetDeployType())
+	}
+	replicas, err := resolvePodSetReplicas(adv, podSet)
+	if err != nil {
+		return nil, err
+	}
+
+	podSetLabel := map[string]string{types.LabelKeyPodSetName: podSet.Name}
+	selector := podSpec.Selector.DeepCopy()
+	selector.MatchLabels = utils.MergeMap(selector.MatchLabels, podSetLabel)
+	template := podSpec.Template.DeepCopy()
+	template.Labels = utils.MergeMap(template.Labels, podSetLabel)
+	meta := metav1.ObjectMeta{
+		Name:      podSet.Name,
+		Namespace: adv.Namespace,
+	}
+
+	var obj runtime.Object
+	switch podSpec.GetDeployType() {
+	case workloadv1beta1.DeployTypeDeployment:
+		obj = &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: types.DeploymentKind},
+			ObjectMeta: meta,
+			Spec: appsv1.DeploymentSpec{
+				Replicas: replicas,
+				Selector: selector,
+				Template: *template,
+			},
+		}
+	case workloadv1beta1.DeployTypeStatefulSet:
+		obj = &appsv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: types.StatefulSetKind},
+			ObjectMeta: meta,
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:    replicas,
+				Selector:    selector,
+				Template:    *template,
+				ServiceName: statefulSetServiceName(adv),
+			},
+		}
+	default:
+		return nil, fmt.Errorf("deployType %s is not a workload type", podSpec.GetDeployType())
+	}
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("convert podSet %s workload to unstructured failed: %v", podSet.Name, err)
+	}
+	return helm.NewK8sObject(&unstructured.Unstructured{Object: u}, nil, nil), nil
+}
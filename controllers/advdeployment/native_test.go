@@ -0,0 +1,140 @@
+package advdeployment
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestBuildPodSetWorkload(t *testing.T) {
+	var replicas int32 = 10
+	adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	adv.Spec.Replicas = &replicas
+	adv.Spec.PodSpec = workloadv1beta1.PodSpec{
+		Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+		Template: &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "app"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx:1.20"}}},
+		},
+	}
+	percent := intstr.FromString("30%")
+	podSet := &workloadv1beta1.PodSet{Name: "app-blue", Replicas: &percent}
+
+	expectSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app", types.LabelKeyPodSetName: "app-blue"}}
+	expectLabels := map[string]string{"app": "app", types.LabelKeyPodSetName: "app-blue"}
+
+	t.Run("deployment", func(t *testing.T) {
+		obj, err := buildPodSetWorkload(adv, podSet)
+		if err != nil {
+			t.Fatalf("build workload failed: %v", err)
+		}
+		deploy := &appsv1.Deployment{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredObject().Object, deploy); err != nil {
+			t.Fatalf("convert deployment failed: %v", err)
+		}
+		if obj.GroupKind().Kind != types.DeploymentKind || deploy.Name != "app-blue" || deploy.Namespace != "default" {
+			t.Errorf("expect Deployment default/app-blue, but got %s %s/%s", obj.GroupKind().Kind, deploy.Namespace, deploy.Name)
+		}
+		if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas != 3 {
+			t.Errorf("expect replicas 3, but got %v", deploy.Spec.Replicas)
+		}
+		if !reflect.DeepEqual(deploy.Spec.Selector, expectSelector) {
+			t.Errorf("expect selector %v, but got %v", expectSelector, deploy.Spec.Selector)
+		}
+		if !reflect.DeepEqual(deploy.Spec.Template.Labels, expectLabels) {
+			t.Errorf("expect template labels %v, but got %v", expectLabels, deploy.Spec.Template.Labels)
+		}
+		if adv.Spec.PodSpec.Selector.MatchLabels[types.LabelKeyPodSetName] != "" {
+			t.Errorf("expect podSpec selector not changed, but got %v", adv.Spec.PodSpec.Selector)
+		}
+	})
+
+	t.Run("statefulset", func(t *testing.T) {
+		adv := adv.DeepCopy()
+		adv.Spec.PodSpec.DeployType = workloadv1beta1.DeployTypeStatefulSet
+		obj, err := buildPodSetWorkload(adv, podSet)
+		if err != nil {
+			t.Fatalf("build workload failed: %v", err)
+		}
+		sts := &appsv1.StatefulSet{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredObject().Object, sts); err != nil {
+			t.Fatalf("convert statefulset failed: %v", err)
+		}
+		if obj.GroupKind().Kind != types.StatefulSetKind || sts.Spec.ServiceName != "app-svc" {
+			t.Errorf("expect StatefulSet with service app-svc, but got %s %s", obj.GroupKind().Kind, sts.Spec.ServiceName)
+		}
+		if !reflect.DeepEqual(sts.Spec.Selector, expectSelector) {
+			t.Errorf("expect selector %v, but got %v", expectSelector, sts.Spec.Selector)
+		}
+	})
+
+	t.Run("without template", func(t *testing.T) {
+		adv := adv.DeepCopy()
+		adv.Spec.PodSpec.Template = nil
+		if _, err := buildPodSetWorkload(adv, podSet); err == nil {
+			t.Errorf("expect error without template, but got nil")
+		}
+	})
+}
+
+func TestBuildWorkloadObjectsHeadlessService(t *testing.T) {
+	adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	adv.Spec.PodSpec = workloadv1beta1.PodSpec{
+		DeployType: workloadv1beta1.DeployTypeStatefulSet,
+		Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}},
+		Template:   &corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "app"}}},
+	}
+	adv.Spec.Topology.PodSets = []*workloadv1beta1.PodSet{{Name: "app-blue"}, {Name: "app-green"}}
+	w := &worker{currentCli: newFakeMingleClient()}
+
+	t.Run("headless service", func(t *testing.T) {
+		objects, err := w.buildWorkloadObjects(adv)
+		if err != nil {
+			t.Fatalf("build workloads failed: %v", err)
+		}
+		if len(objects) != 3 {
+			t.Fatalf("expect 2 StatefulSets and 1 Service, but got %d objects", len(objects))
+		}
+		obj := objects[2].obj
+		svc := &corev1.Service{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredObject().Object, svc); err != nil {
+			t.Fatalf("convert service failed: %v", err)
+		}
+		if svc.Name != "app-svc" || svc.Spec.ClusterIP != corev1.ClusterIPNone {
+			t.Errorf("expect headless Service app-svc, but got %s %s", svc.Name, svc.Spec.ClusterIP)
+		}
+		if !reflect.DeepEqual(svc.Spec.Selector, map[string]string{"app": "app"}) {
+			t.Errorf("expect selector of all podSets, but got %v", svc.Spec.Selector)
+		}
+		if _, ok := svc.Labels[types.LabelKeyPodSetName]; ok {
+			t.Errorf("expect no podSet label, but got %v", svc.Labels)
+		}
+	})
+
+	t.Run("service name from spec", func(t *testing.T) {
+		adv := adv.DeepCopy()
+		serviceName := "app-headless"
+		adv.Spec.ServiceName = &serviceName
+		objects, err := w.buildWorkloadObjects(adv)
+		if err != nil {
+			t.Fatalf("build workloads failed: %v", err)
+		}
+		if len(objects) != 2 {
+			t.Fatalf("expect 2 StatefulSets only, but got %d objects", len(objects))
+		}
+		sts := &appsv1.StatefulSet{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(objects[0].obj.UnstructuredObject().Object, sts); err != nil {
+			t.Fatalf("convert statefulset failed: %v", err)
+		}
+		if sts.Spec.ServiceName != serviceName {
+			t.Errorf("expect serviceName %s, but got %s", serviceName, sts.Spec.ServiceName)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package advdeployment
+
+import (
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	"github.com/symcn/sym-ops/pkg/types"
+	"github.com/symcn/sym-ops/pkg/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/klog/v2"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podSetObject the rendered object and the podSet it belongs to
+type podSetObject struct {
+	podSet *workloadv1beta1.PodSet
+	obj    helm.K8sObject
+}
+
+// trackingLabels returns the labels stamped on the rendered objects of podSet, the workloads are
+// found by them. The cluster name falls back to the connected cluster if adv is not labeled.
+func (w *worker) trackingLabels(adv *workloadv1beta1.AdvDeployment, podSet *workloadv1beta1.PodSet) map[string]string {
+	labels := map[string]string{
+		types.ObserveMustLabelAppName:     adv.Name,
+		types.LabelKeyPodSetName:          podSet.Name,
+		types.ObserveMustLabelClusterName: utils.GetMapWithDefaultValue(adv.Labels, types.ObserveMustLabelClusterName, w.currentCli.GetClusterCfgInfo().GetName()),
+	}
+	if zone := adv.Labels[types.LabelKeyZone]; zone != "" {
+		labels[types.LabelKeyZone] = zone
+	}
+	return labels
+}
+
+// getPodTemplate returns the pod template of workload, nil if obj is not a workload
+func getPodTemplate(obj rtclient.Object) *corev1.PodTemplateSpec {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template
+	case *batchv1.Job:
+		return &o.Spec.Template
+	}
+	return nil
+}
+
+// applyPodSetOverrides apply podSet topology and image to the rendered workload, the main
+// container is named as the app name.
+func applyPodSetOverrides(obj rtclient.Object, appName string, podSet *workloadv1beta1.PodSet) {
+	template := getPodTemplate(obj)
+	if template == nil || podSet == nil {
+		return
+	}
+
+	mergeNodeSelectorTerm(&template.Spec, podSet.NodeSelectorTerm)
+
+	if podSet.Image != "" || podSet.Version != "" {
+		if !utils.SetPodContainerImageVersion(appName, &template.Spec, podSet.Image, podSet.Version) {
+			klog.Warningf("PodSet %s set image %s version %s failed, container %s not found in %s %s", podSet.Name, podSet.Image, podSet.Version, appName, obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName())
+		}
+	}
+}
+
+// mergeNodeSelectorTerm merge term into the required node affinity. The required nodeSelectorTerms
+// are ORed, so the term requirements are appended to each of them to restrict all, if there is
+// no nodeSelectorTerms, the term is used directly.
+func mergeNodeSelectorTerm(podSpec *corev1.PodSpec, term *corev1.NodeSelectorTerm) {
+	if term == nil || (len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0) {
+		return
+	}
+
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.NodeAffinity == nil {
+		podSpec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	nodeAffinity := podSpec.Affinity.NodeAffinity
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	required := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{*term.DeepCopy()}
+		return
+	}
+	for i := range required.NodeSelectorTerms {
+		t := &required.NodeSelectorTerms[i]
+		t.MatchExpressions = appendRequirements(t.MatchExpressions, term.MatchExpressions)
+		t.MatchFields = appendRequirements(t.MatchFields, term.MatchFields)
+	}
+}
+
+// appendRequirements append the requirements which are not exist
+func appendRequirements(list []corev1.NodeSelectorRequirement, add []corev1.NodeSelectorRequirement) []corev1.NodeSelectorRequirement {
+	for _, r := range add {
+		exist := false
+		for _, item := range list {
+			if equality.Semantic.DeepEqual(item, r) {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			list = append(list, *r.DeepCopy())
+		}
+	}
+	return list
+}
@@ -0,0 +1,106 @@
+package advdeployment
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newRequirement(key string, values ...string) corev1.NodeSelectorRequirement {
+	return corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpIn, Values: values}
+}
+
+func TestMergeNodeSelectorTerm(t *testing.T) {
+	zone := corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{newRequirement("zone", "gz01")}}
+
+	args := []struct {
+		name   string
+		spec   *corev1.PodSpec
+		term   *corev1.NodeSelectorTerm
+		expect []corev1.NodeSelectorTerm
+	}{
+		{
+			name:   "nil term",
+			spec:   &corev1.PodSpec{},
+			term:   nil,
+			expect: nil,
+		},
+		{
+			name:   "no affinity",
+			spec:   &corev1.PodSpec{},
+			term:   &zone,
+			expect: []corev1.NodeSelectorTerm{zone},
+		},
+		{
+			name: "restrict each chart term",
+			spec: &corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{MatchExpressions: []corev1.NodeSelectorRequirement{newRequirement("disk", "ssd")}},
+					{MatchExpressions: []corev1.NodeSelectorRequirement{newRequirement("gpu", "true")}},
+				}},
+			}}},
+			term: &zone,
+			expect: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{newRequirement("disk", "ssd"), newRequirement("zone", "gz01")}},
+				{MatchExpressions: []corev1.NodeSelectorRequirement{newRequirement("gpu", "true"), newRequirement("zone", "gz01")}},
+			},
+		},
+		{
+			name: "requirement already exist",
+			spec: &corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{zone}},
+			}}},
+			term:   &zone,
+			expect: []corev1.NodeSelectorTerm{zone},
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			mergeNodeSelectorTerm(arg.spec, arg.term)
+
+			var got []corev1.NodeSelectorTerm
+			if arg.spec.Affinity != nil && arg.spec.Affinity.NodeAffinity != nil && arg.spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+				got = arg.spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			}
+			if !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestApplyPodSetOverrides(t *testing.T) {
+	term := &corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{newRequirement("zone", "gz01")}}
+	deploy := &appsv1.Deployment{}
+	applyPodSetOverrides(deploy, "app", &workloadv1beta1.PodSet{Name: "blue", NodeSelectorTerm: term})
+
+	affinity := deploy.Spec.Template.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatal("required node affinity is not set")
+	}
+	if !reflect.DeepEqual(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms, []corev1.NodeSelectorTerm{*term}) {
+		t.Errorf("unexpected node selector terms %v", affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+	}
+
+	// service is not a workload, nothing happened
+	applyPodSetOverrides(&corev1.Service{}, "app", &workloadv1beta1.PodSet{Name: "blue", NodeSelectorTerm: term})
+}
+
+func TestApplyPodSetImageOverrides(t *testing.T) {
+	deploy := &appsv1.Deployment{}
+	deploy.Spec.Template.Spec.Containers = []corev1.Container{
+		{Name: "sidecar", Image: "sidecar:v1"},
+		{Name: "app", Image: "app:v1"},
+	}
+	applyPodSetOverrides(deploy, "app", &workloadv1beta1.PodSet{Name: "blue", Version: "v2"})
+
+	if deploy.Spec.Template.Spec.Containers[1].Image != "app:v2" {
+		t.Errorf("expect main container image app:v2, but got %s", deploy.Spec.Template.Spec.Containers[1].Image)
+	}
+	if deploy.Spec.Template.Spec.Containers[0].Image != "sidecar:v1" {
+		t.Errorf("sidecar container image should not be modified, but got %s", deploy.Spec.Template.Spec.Containers[0].Image)
+	}
+}
@@ -0,0 +1,163 @@
+package advdeployment
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+var lastIntRegexp = regexp.MustCompile(`[0-9]+`)
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;patch
+
+// stepUpdatePriority set the pod deletion cost of the Deployment pods from priorityStrategy before
+// applying, the old ReplicaSet deletes pods with lower cost first when rolling update, so the pods
+// with higher priority are replaced first. StatefulSet pods are always updated in ordinal order.
+// The pods are not cached, they are listed from the apiserver by the podSet tracking labels.
+func (w *worker) stepUpdatePriority(ctx context.Context, req ktypes.NamespacedName, adv *workloadv1beta1.AdvDeployment) error {
+	strategy := adv.Spec.UpdateStrategy.PriorityStrategy
+	if strategy == nil || (len(strategy.OrderPriority) == 0 && len(strategy.WeightPriority) == 0) {
+		return nil
+	}
+
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		if podSet == nil {
+			continue
+		}
+		if err := w.updatePodSetPriority(adv, podSet, strategy); err != nil {
+			return fmt.Errorf("Advdeployment %s podSet %s update priority failed: %v", req, podSet.Name, err)
+		}
+	}
+	return nil
+}
+
+// updatePodSetPriority set the pod deletion cost of the podSet pods in priority order
+func (w *worker) updatePodSetPriority(adv *workloadv1beta1.AdvDeployment, podSet *workloadv1beta1.PodSet, strategy *workloadv1beta1.UpdatePriorityStrategy) error {
+	podCli := w.currentCli.GetKubeInterface().CoreV1().Pods(adv.Namespace)
+	podList, err := podCli.List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(w.trackingLabels(adv, podSet)).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("get pod list failed: %v", err)
+	}
+	var pods []*corev1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.DeletionTimestamp == nil && isOwnedByKind(pod, types.ReplicaSetKind) {
+			pods = append(pods, pod)
+		}
+	}
+
+	if err = sortPodsByPriority(pods, strategy); err != nil {
+		return fmt.Errorf("sort pods by priority failed: %v", err)
+	}
+	for i, pod := range pods {
+		cost := strconv.Itoa(i)
+		if pod.Annotations[corev1.PodDeletionCost] == cost {
+			continue
+		}
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, corev1.PodDeletionCost, cost)
+		if _, err = podCli.Patch(context.TODO(), pod.Name, ktypes.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			klog.Errorf("Patch pod %s/%s deletion cost failed: %v", pod.Namespace, pod.Name, err)
+			continue
+		}
+		klog.V(4).Infof("Patch pod %s/%s deletion cost %s successfully", pod.Namespace, pod.Name, cost)
+	}
+	return nil
+}
+
+// sortPodsByPriority sort pods by priority from high to low, the pods to update first come first.
+// Pods with the same priority are in name order, so the deletion costs are stable.
+func sortPodsByPriority(pods []*corev1.Pod, strategy *workloadv1beta1.UpdatePriorityStrategy) error {
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	if len(strategy.WeightPriority) > 0 {
+		selectors := make([]labels.Selector, 0, len(strategy.WeightPriority))
+		for i := range strategy.WeightPriority {
+			selector, err := metav1.LabelSelectorAsSelector(&strategy.WeightPriority[i].MatchSelector)
+			if err != nil {
+				return err
+			}
+			selectors = append(selectors, selector)
+		}
+		weights := make(map[*corev1.Pod]int64, len(pods))
+		for _, pod := range pods {
+			weights[pod] = podPriorityWeight(pod, strategy.WeightPriority, selectors)
+		}
+		sort.SliceStable(pods, func(i, j int) bool {
+			return weights[pods[i]] > weights[pods[j]]
+		})
+		return nil
+	}
+
+	sort.SliceStable(pods, func(i, j int) bool {
+		return orderPriorityLess(pods[i], pods[j], strategy.OrderPriority)
+	})
+	return nil
+}
+
+// podPriorityWeight the sum of weights of the terms the pod labels match
+func podPriorityWeight(pod *corev1.Pod, terms []workloadv1beta1.UpdatePriorityWeightTerm, selectors []labels.Selector) int64 {
+	var weight int64
+	podLabels := labels.Set(pod.Labels)
+	for i, selector := range selectors {
+		if selector.Matches(podLabels) {
+			weight += int64(terms[i].Weight)
+		}
+	}
+	return weight
+}
+
+// orderPriorityLess the pod with the key of a former term comes first, then the pod with bigger
+// int in the key value comes first
+func orderPriorityLess(a, b *corev1.Pod, terms []workloadv1beta1.UpdatePriorityOrderTerm) bool {
+	for _, term := range terms {
+		aValue, aOk := a.Labels[term.OrderedKey]
+		bValue, bOk := b.Labels[term.OrderedKey]
+		if !aOk && !bOk {
+			continue
+		}
+		if aOk != bOk {
+			return aOk
+		}
+		aInt, bInt := getLastInt(aValue), getLastInt(bValue)
+		if aInt != bInt {
+			return aInt > bInt
+		}
+	}
+	return false
+}
+
+// getLastInt returns the last int in value, such as 5 in '5' and 10 in 'sts-10', -1 if there is
+// no int in value
+func getLastInt(value string) int64 {
+	ints := lastIntRegexp.FindAllString(value, -1)
+	if len(ints) == 0 {
+		return -1
+	}
+	i, err := strconv.ParseInt(ints[len(ints)-1], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+func isOwnedByKind(obj metav1.Object, kind string) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package advdeployment
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newPriorityPod(name string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func podNames(pods []*corev1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestGetLastInt(t *testing.T) {
+	args := []struct {
+		value  string
+		expect int64
+	}{
+		{value: "5", expect: 5},
+		{value: "sts-10", expect: 10},
+		{value: "rz01-blue-3", expect: 3},
+		{value: "v1.20", expect: 20},
+		{value: "blue", expect: -1},
+		{value: "", expect: -1},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.value, func(t *testing.T) {
+			if got := getLastInt(arg.value); got != arg.expect {
+				t.Errorf("expect %d, but got %d", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestSortPodsByPriority(t *testing.T) {
+	args := []struct {
+		name     string
+		pods     []*corev1.Pod
+		strategy *workloadv1beta1.UpdatePriorityStrategy
+		expect   []string
+	}{
+		{
+			name: "order priority",
+			pods: []*corev1.Pod{
+				newPriorityPod("a", nil),
+				newPriorityPod("b", map[string]string{"key2": "2"}),
+				newPriorityPod("c", map[string]string{"key1": "sts-1"}),
+				newPriorityPod("d", map[string]string{"key1": "sts-10", "key2": "1"}),
+				newPriorityPod("e", map[string]string{"key1": "none"}),
+				newPriorityPod("f", map[string]string{"key2": "5"}),
+			},
+			strategy: &workloadv1beta1.UpdatePriorityStrategy{
+				OrderPriority: []workloadv1beta1.UpdatePriorityOrderTerm{{OrderedKey: "key1"}, {OrderedKey: "key2"}},
+			},
+			expect: []string{"d", "c", "e", "f", "b", "a"},
+		},
+		{
+			name: "order priority same value",
+			pods: []*corev1.Pod{
+				newPriorityPod("c", map[string]string{"key1": "1", "key2": "1"}),
+				newPriorityPod("b", map[string]string{"key1": "1", "key2": "2"}),
+				newPriorityPod("a", map[string]string{"key1": "1"}),
+			},
+			strategy: &workloadv1beta1.UpdatePriorityStrategy{
+				OrderPriority: []workloadv1beta1.UpdatePriorityOrderTerm{{OrderedKey: "key1"}, {OrderedKey: "key2"}},
+			},
+			expect: []string{"b", "c", "a"},
+		},
+		{
+			name: "weight priority",
+			pods: []*corev1.Pod{
+				newPriorityPod("a", map[string]string{"zone": "rz"}),
+				newPriorityPod("b", map[string]string{"zone": "gz", "canary": "true"}),
+				newPriorityPod("c", map[string]string{"zone": "gz"}),
+				newPriorityPod("d", nil),
+				newPriorityPod("e", map[string]string{"zone": "rz", "canary": "true"}),
+			},
+			strategy: &workloadv1beta1.UpdatePriorityStrategy{
+				WeightPriority: []workloadv1beta1.UpdatePriorityWeightTerm{
+					{Weight: 50, MatchSelector: metav1.LabelSelector{MatchLabels: map[string]string{"canary": "true"}}},
+					{Weight: 20, MatchSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "zone", Operator: metav1.LabelSelectorOpIn, Values: []string{"gz"}},
+					}}},
+				},
+			},
+			expect: []string{"b", "e", "c", "a", "d"},
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			if err := sortPodsByPriority(arg.pods, arg.strategy); err != nil {
+				t.Fatalf("sort pods failed: %v", err)
+			}
+			if got := podNames(arg.pods); !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestStepUpdatePriority(t *testing.T) {
+	newPod := func(name, namespace, appName, podSetName, key1 string) *corev1.Pod {
+		pod := newPriorityPod(name, map[string]string{
+			types.ObserveMustLabelAppName:     appName,
+			types.LabelKeyPodSetName:          podSetName,
+			types.ObserveMustLabelClusterName: "cluster-a",
+			"key1":                            key1,
+		})
+		pod.Namespace = namespace
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: types.ReplicaSetKind, Name: name + "-rs"}}
+		return pod
+	}
+	notOwned := newPod("blue-d", "default", "app", "blue", "9")
+	notOwned.OwnerReferences = nil
+
+	// the pods are only in the apiserver, the cache of currentCli is empty
+	cli := newFakeMingleClient()
+	cli.kubeCli = kubefake.NewSimpleClientset(
+		newPod("blue-a", "default", "app", "blue", "1"),
+		newPod("blue-b", "default", "app", "blue", "2"),
+		newPod("green-a", "default", "app", "green", "1"),
+		newPod("blue-c", "other", "app", "blue", "3"),
+		newPod("other-a", "default", "other", "blue", "3"),
+		notOwned,
+	)
+	w := &worker{currentCli: cli}
+
+	adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	adv.Spec.Topology.PodSets = []*workloadv1beta1.PodSet{{Name: "blue"}, {Name: "green"}}
+	adv.Spec.UpdateStrategy.PriorityStrategy = &workloadv1beta1.UpdatePriorityStrategy{
+		OrderPriority: []workloadv1beta1.UpdatePriorityOrderTerm{{OrderedKey: "key1"}},
+	}
+	if err := w.stepUpdatePriority(context.TODO(), ktypes.NamespacedName{Namespace: "default", Name: "app"}, adv); err != nil {
+		t.Fatalf("update priority failed: %v", err)
+	}
+
+	args := []struct {
+		namespace string
+		name      string
+		expect    string
+	}{
+		{namespace: "default", name: "blue-b", expect: "0"},
+		{namespace: "default", name: "blue-a", expect: "1"},
+		{namespace: "default", name: "green-a", expect: "0"},
+		{namespace: "other", name: "blue-c", expect: ""},
+		{namespace: "default", name: "other-a", expect: ""},
+		{namespace: "default", name: "blue-d", expect: ""},
+	}
+	for _, arg := range args {
+		t.Run(arg.namespace+"/"+arg.name, func(t *testing.T) {
+			pod, err := cli.kubeCli.CoreV1().Pods(arg.namespace).Get(context.TODO(), arg.name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get pod failed: %v", err)
+			}
+			if got := pod.Annotations[corev1.PodDeletionCost]; got != arg.expect {
+				t.Errorf("expect deletion cost %q, but got %q", arg.expect, got)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/symcn/pkg/clustermanager/workqueue"
 	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
 	symctx "github.com/symcn/sym-ops/pkg/context"
+	"github.com/symcn/sym-ops/pkg/helm"
 	"github.com/symcn/sym-ops/pkg/types"
 	"github.com/symcn/sym-ops/pkg/utils"
 	appsv1 "k8s.io/api/apps/v1"
@@ -22,9 +23,12 @@ import (
 )
 
 type worker struct {
-	currentCli api.MingleClient
-	stepList   []step
-	conf       *AdvConfig
+	currentCli   api.MingleClient
+	stepList     []step
+	conf         *AdvConfig
+	chartFetcher *helm.ChartFetcher
+	capabilities *helm.CapabilitiesCache
+	renderCache  *helm.RenderCache
 }
 
 // WorkerFeature worker feature
@@ -32,9 +36,20 @@ func WorkerFeature(currentCli api.MingleClient, threadiness int, gotInterval tim
 	if advConf == nil {
 		advConf = DefaultAdvConfig()
 	}
+	chartFetcher, err := helm.NewChartFetcher(advConf.Chart)
+	if err != nil {
+		return err
+	}
+	renderCache, err := helm.NewRenderCache(advConf.RenderCacheSize)
+	if err != nil {
+		return err
+	}
 	w := &worker{
-		currentCli: currentCli,
-		conf:       advConf,
+		currentCli:   currentCli,
+		conf:         advConf,
+		chartFetcher: chartFetcher,
+		capabilities: helm.NewCapabilitiesCache(currentCli.GetKubeInterface().Discovery(), advConf.CapabilitiesTTL),
+		renderCache:  renderCache,
 	}
 
 	w.initialization()
@@ -105,6 +120,7 @@ func (w *worker) registryStep() {
 	w.stepList = []step{
 		w.stepCheckDeletionTime,
 		w.stepCheckType,
+		w.stepUpdatePriority,
 		w.stepApplyResources,
 		w.stepRecalculateStatus,
 		w.stepUpdateStatus,
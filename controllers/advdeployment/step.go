@@ -12,6 +12,7 @@ import (
 	"github.com/symcn/sym-ops/pkg/resource"
 	"github.com/symcn/sym-ops/pkg/types"
 	"github.com/symcn/sym-ops/pkg/utils"
+	"helm.sh/helm/v3/pkg/release"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/autoscaling/v2beta2"
 	batchv1 "k8s.io/api/batch/v1"
@@ -20,7 +21,9 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
@@ -47,16 +50,29 @@ func (w *worker) stepCheckType(ctx context.Context, req ktypes.NamespacedName, a
 		}
 	}()
 
-	if adv.Spec.PodSpec.DeployType != "helm" {
-		err = fmt.Errorf("Advdeployment %s not supported type %s", req, adv.Spec.PodSpec.DeployType)
-		return err
-	}
-	if adv.Spec.PodSpec.Chart == nil {
-		err = fmt.Errorf("Advdeployment %s chart is nil", req)
-		return err
-	}
-	if adv.Spec.PodSpec.Chart.CharURL == nil && adv.Spec.PodSpec.Chart.RawChart == nil {
-		err = fmt.Errorf("Advdeployment %s char url and raw chart not both nil", req)
+	podSpec := adv.Spec.PodSpec
+	switch podSpec.GetDeployType() {
+	case workloadv1beta1.DeployTypeHelm, workloadv1beta1.DeployTypeKustomize:
+		if podSpec.Chart == nil {
+			err = fmt.Errorf("Advdeployment %s chart is nil", req)
+			return err
+		}
+		if podSpec.Chart.CharURL == nil && podSpec.Chart.RawChart == nil && podSpec.Chart.ChartFrom == nil {
+			err = fmt.Errorf("Advdeployment %s char url, raw chart and chart from are all nil", req)
+			return err
+		}
+	case workloadv1beta1.DeployTypeManifests:
+		if podSpec.Chart == nil || (podSpec.Chart.RawManifests == "" && podSpec.Chart.ChartFrom == nil) {
+			err = fmt.Errorf("Advdeployment %s raw manifests and chart from are both nil", req)
+			return err
+		}
+	case workloadv1beta1.DeployTypeDeployment, workloadv1beta1.DeployTypeStatefulSet:
+		if podSpec.Selector == nil || podSpec.Template == nil {
+			err = fmt.Errorf("Advdeployment %s selector or template is nil", req)
+			return err
+		}
+	default:
+		err = fmt.Errorf("Advdeployment %s not supported type %s", req, podSpec.DeployType)
 		return err
 	}
 	return nil
@@ -72,17 +88,24 @@ func (w *worker) stepApplyResources(ctx context.Context, req ktypes.NamespacedNa
 		}
 	}()
 
-	var (
-		objects []helm.K8sObject
-	)
-	for _, podSet := range adv.Spec.Topology.PodSets {
-		_, _, rawChart := getCharInfo(podSet, adv)
-		objs, err := helm.RenderTemplate(rawChart, podSet.Name, adv.Namespace, podSet.RawValues)
-		if err != nil {
-			return err
-		}
-		objects = append(objects, objs...)
+	var objects []podSetObject
+	switch adv.Spec.PodSpec.GetDeployType() {
+	case workloadv1beta1.DeployTypeHelm:
+		objects, err = w.renderPodSetObjects(req, adv)
+	case workloadv1beta1.DeployTypeManifests:
+		objects, err = w.buildManifestsObjects(adv)
+	case workloadv1beta1.DeployTypeKustomize:
+		objects, err = w.renderKustomizeObjects(adv)
+	default:
+		objects, err = w.buildWorkloadObjects(adv)
+	}
+	if err != nil {
+		return err
 	}
+	// install dependencies such as ConfigMap and ServiceAccount of all podSets before workloads
+	sort.SliceStable(objects, func(i, j int) bool {
+		return helm.InstallOrderLess(objects[i].obj.GroupKind().Kind, objects[j].obj.GroupKind().Kind)
+	})
 
 	ownerRes := []string{}
 	isHpaEnable := getHpaSpecEnable(adv.Annotations)
@@ -93,24 +116,37 @@ func (w *worker) stepApplyResources(ctx context.Context, req ktypes.NamespacedNa
 		opt      resource.Option
 		replicas int32
 	)
-	for _, obj := range objects {
+	for _, item := range objects {
+		obj := item.obj
+		if _, ok := obj.UnstructuredObject().GetAnnotations()[release.HookAnnotation]; ok {
+			// hooks and tests are run by helm on release events, never installed as resources
+			klog.V(4).Infof("Skip hook %s %s/%s", obj.GroupKind().Kind, obj.GetNamespace(), obj.GetName())
+			continue
+		}
 		yaml := obj.YAML2String()
 		klog.V(5).Infof("%s %s/%s yaml: %s", obj.GroupKind().Kind, obj.GetNamespace(), obj.GetName(), yaml)
 
 		covert, ok := convertFactory[obj.GroupKind().Kind]
 		if !ok {
-			return fmt.Errorf("Apply resource %s %s/%s unsupport type", obj.GroupKind().Kind, obj.GetNamespace(), obj.GetName())
+			// no special defaulting, apply as unstructured
+			covert = w.convertToUnstructured
 		}
 		rtobj, opt, replicas, err = covert(obj.UnstructuredObject(), isHpaEnable)
 		if err != nil {
 			return err
 		}
-		ownerRes = append(ownerRes, getFormattedName(obj.GroupKind().Kind, rtobj))
+		opt.Namespace = adv.Namespace
+		if _, ok := rtobj.(*unstructured.Unstructured); !ok && rtobj.GetNamespace() == "" {
+			// the typed kinds are all namespaced, unstructured ones are defaulted by Reconcile
+			rtobj.SetNamespace(adv.Namespace)
+		}
+		applyPodSetOverrides(rtobj, adv.Name, item.podSet)
 		changed, err = resource.Reconcile(ctx, w.currentCli, rtobj, opt)
 		if err != nil {
 			symctx.WithValue(ctx, types.ContextKeyStepStop, true)
 			return fmt.Errorf("Apply resource failed: %v", err)
 		}
+		ownerRes = append(ownerRes, getFormattedName(obj.GroupKind().String(), rtobj))
 		if obj.GroupKind().Kind == types.DeploymentKind || obj.GroupKind().Kind == types.StatefulSetKind {
 			err = w.applyHorizontalPodAutoscaler(ctx, adv, obj, types.HorizontalAPIVersion, replicas)
 			if err != nil {
@@ -129,6 +165,49 @@ func (w *worker) stepApplyResources(ctx context.Context, req ktypes.NamespacedNa
 	return nil
 }
 
+// renderPodSetObjects render the chart of every podSet with its values
+func (w *worker) renderPodSetObjects(req ktypes.NamespacedName, adv *workloadv1beta1.AdvDeployment) ([]podSetObject, error) {
+	var (
+		objects    []podSetObject
+		objs       []helm.K8sObject
+		values     string
+		valuesFrom []string
+		rawChart   []byte
+	)
+	caps, err := w.capabilities.Get()
+	if err != nil {
+		return nil, err
+	}
+	lookup := w.getLookupConfig(adv.Namespace)
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		rawChart, err = w.getChart(podSet, adv)
+		if err != nil {
+			return nil, err
+		}
+		valuesFrom, err = w.getValuesFrom(podSet, adv.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		values, err = buildPodSetValues(adv, podSet, valuesFrom)
+		if err != nil {
+			return nil, err
+		}
+		// rendering is skipped if chart, values and capabilities are not changed
+		objs, err = w.renderCache.RenderTemplate(rawChart, podSet.Name, adv.Namespace, values, caps, lookup)
+		if err != nil {
+			if schemaErr, ok := err.(*helm.SchemaError); ok {
+				w.reportSchemaError(req, adv, podSet.Name, schemaErr)
+			}
+			return nil, err
+		}
+		helm.AddTrackingLabels(objs, w.trackingLabels(adv, podSet))
+		for _, obj := range objs {
+			objects = append(objects, podSetObject{podSet: podSet, obj: obj})
+		}
+	}
+	return objects, nil
+}
+
 func (w *worker) applyHorizontalPodAutoscaler(ctx context.Context, adv *workloadv1beta1.AdvDeployment, obj helm.K8sObject, apiVersion string, currentReplicas int32) error {
 	enable := getHpaSpecEnable(adv.Annotations)
 	if !enable || currentReplicas == 0 {
@@ -229,15 +308,16 @@ func (w *worker) stepRecalculateStatus(ctx context.Context, key ktypes.Namespace
 	if o, ok := symctx.GetValue(ctx, types.ContextKeyAdvdeploymentOwnerRes).([]string); ok {
 		owners = o
 	}
+	removedObjects := w.getRemovedObjects(adv, owners)
 
 	// deployment check
 	deploys, err := w.getDeployListByLabels(adv)
 	if err != nil {
 		return err
 	}
-	if len(deploys) > 1 {
+	if len(deploys) > 0 {
 		unusedObjects, status, updatedReplicas, generationEqual := w.loopDeploys(adv, deploys, owners)
-		w.dealAggreStatus(ctx, status, generationEqual, updatedReplicas, unusedObjects)
+		w.dealAggreStatus(ctx, status, generationEqual, updatedReplicas, append(unusedObjects, removedObjects...))
 		return nil
 	}
 
@@ -246,9 +326,9 @@ func (w *worker) stepRecalculateStatus(ctx context.Context, key ktypes.Namespace
 	if err != nil {
 		return err
 	}
-	if len(statefulsets) > 1 {
+	if len(statefulsets) > 0 {
 		unusedObjects, status, updatedReplicas, generationEqual := w.loopStatefulSet(adv, statefulsets, owners)
-		w.dealAggreStatus(ctx, status, generationEqual, updatedReplicas, unusedObjects)
+		w.dealAggreStatus(ctx, status, generationEqual, updatedReplicas, append(unusedObjects, removedObjects...))
 		return nil
 	}
 
@@ -257,32 +337,43 @@ func (w *worker) stepRecalculateStatus(ctx context.Context, key ktypes.Namespace
 	if err != nil {
 		return err
 	}
-	if len(statefulsets) > 1 {
+	if len(jobs) > 0 {
 		unusedObjects, status, updatedReplicas, generationEqual := w.loopJob(adv, jobs, owners)
-		w.dealAggreStatus(ctx, status, generationEqual, updatedReplicas, unusedObjects)
+		w.dealAggreStatus(ctx, status, generationEqual, updatedReplicas, append(unusedObjects, removedObjects...))
 		return nil
 	}
 
+	// no workloads to wait for
+	w.deleteUnusedObjects(removedObjects)
 	return nil
 }
 
+// checkServiceOwner set the owner of the Services labeled with the app tracking label, and the
+// ones labeled <name>-svc which are created before the tracking labels.
 func (w *worker) checkServiceOwner(adv *workloadv1beta1.AdvDeployment) {
+	appReq, err := labels.NewRequirement(types.ObserveMustLabelAppName, selection.In, []string{adv.Name, adv.Name + types.ServiceNameSuffix})
+	if err != nil {
+		klog.Errorf("build service selector %s/%s failed: %v", adv.Namespace, adv.Name, err)
+		return
+	}
 	svcList := &corev1.ServiceList{}
-	err := w.currentCli.List(svcList, &rtclient.ListOptions{
+	err = w.currentCli.List(svcList, &rtclient.ListOptions{
 		Namespace:     adv.Namespace,
-		LabelSelector: labels.Set{types.ObserveMustLabelAppName: adv.Name + types.ServiceNameSuffix}.AsSelector(),
+		LabelSelector: labels.NewSelector().Add(*appReq),
 	})
 	if err != nil {
 		klog.Errorf("get service list %s/%s failed: %v", adv.Namespace, adv.Name, err)
 		return
 	}
 
-	if len(svcList.Items) != 1 {
-		klog.Errorf("service list %s/%s have more or less len %d", adv.Namespace, adv.Name, len(svcList.Items))
+	if len(svcList.Items) == 0 {
+		klog.V(4).Infof("service list %s/%s is empty", adv.Namespace, adv.Name)
 		return
 	}
 
-	w.setControllerReference(adv, &svcList.Items[0])
+	for i := range svcList.Items {
+		w.setControllerReference(adv, &svcList.Items[i])
+	}
 }
 
 func (w *worker) setControllerReference(adv *workloadv1beta1.AdvDeployment, obj rtclient.Object) {
@@ -352,7 +443,7 @@ func (w *worker) loopDeploys(adv *workloadv1beta1.AdvDeployment, deploys []appsv
 	for _, deploy := range deploys {
 		w.setControllerReference(adv, &deploy)
 
-		if isUnunseObject(types.DeploymentKind, &deploy, owners) {
+		if isUnunseObject(deploymentGroupKind, &deploy, owners) {
 			unusedObjects = append(unusedObjects, &deploy)
 			continue
 		}
@@ -396,7 +487,7 @@ func (w *worker) loopStatefulSet(adv *workloadv1beta1.AdvDeployment, statefulSet
 	for _, statefulset := range statefulSets {
 		w.setControllerReference(adv, &statefulset)
 
-		if isUnunseObject(types.DeploymentKind, &statefulset, owners) {
+		if isUnunseObject(statefulSetGroupKind, &statefulset, owners) {
 			unusedObjects = append(unusedObjects, &statefulset)
 			continue
 		}
@@ -437,7 +528,7 @@ func (w *worker) loopJob(adv *workloadv1beta1.AdvDeployment, jobs []batchv1.Job,
 	for _, job := range jobs {
 		w.setControllerReference(adv, &job)
 
-		if isUnunseObject(types.DeploymentKind, &job, owners) {
+		if isUnunseObject(jobGroupKind, &job, owners) {
 			unusedObjects = append(unusedObjects, &job)
 			continue
 		}
@@ -489,9 +580,69 @@ func (w *worker) dealAggreStatus(ctx context.Context, status *workloadv1beta1.Ad
 	}
 
 	if status.Desired > status.Available {
+		// the removed objects are kept in status until they are deleted, workloads are found by labels
+		status.OwnerResource = append([]string{}, status.OwnerResource...)
+		for _, obj := range unUseObj {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				status.OwnerResource = append(status.OwnerResource, getFormattedName(u.GroupVersionKind().GroupKind().String(), u))
+			}
+		}
 		return
 	}
+	w.deleteUnusedObjects(unUseObj)
+}
 
+// getRemovedObjects returns the objects in the last owner resources but not in owners, except the
+// workloads which are found by labels. The ones not labeled with adv any more are never returned.
+func (w *worker) getRemovedObjects(adv *workloadv1beta1.AdvDeployment, owners []string) []rtclient.Object {
+	if len(owners) == 0 {
+		// if owners is empty, shouldn't mark unused
+		return nil
+	}
+	current := map[string]struct{}{}
+	for _, owner := range owners {
+		current[owner] = struct{}{}
+	}
+
+	var removed []rtclient.Object
+	for _, item := range adv.Status.AggrStatus.OwnerResource {
+		if _, ok := current[item]; ok {
+			continue
+		}
+		gk, key, ok := parseFormattedName(item)
+		if !ok {
+			continue
+		}
+		switch gk.String() {
+		case deploymentGroupKind, statefulSetGroupKind, jobGroupKind:
+			continue
+		}
+		mapping, err := w.currentCli.GetCtrlRtManager().GetRESTMapper().RESTMapping(gk)
+		if err != nil {
+			klog.V(4).Infof("Removed resource %s is not served: %v", item, err)
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(mapping.GroupVersionKind)
+		if err = w.currentCli.Get(key, obj); err != nil {
+			if !apierrors.IsNotFound(err) {
+				klog.Errorf("Get removed resource %s failed: %v", item, err)
+			}
+			continue
+		}
+		if obj.GetLabels()[types.ObserveMustLabelAppName] != adv.Name {
+			continue
+		}
+		removed = append(removed, obj)
+	}
+	return removed
+}
+
+func (w *worker) deleteUnusedObjects(unUseObj []rtclient.Object) {
+	sort.SliceStable(unUseObj, func(i, j int) bool {
+		return helm.UninstallOrderLess(getObjectKind(unUseObj[i]), getObjectKind(unUseObj[j]))
+	})
 	for _, unobj := range unUseObj {
 		err := w.currentCli.Delete(unobj)
 		if err != nil {
@@ -527,7 +678,7 @@ func (w *worker) stepUpdateStatus(ctx context.Context, req ktypes.NamespacedName
 		return fmt.Errorf("get adveployment %s failed: %v", req, err)
 	}
 
-	if obj.Status.ObservedGeneration == obj.ObjectMeta.Generation && equality.Semantic.DeepEqual(&obj.Status.AggrStatus, status) {
+	if obj.Status.ObservedGeneration == obj.ObjectMeta.Generation && equality.Semantic.DeepEqual(&obj.Status.AggrStatus, status) && reconciledCondition(&obj.Status) == nil {
 		klog.V(4).Infof("Advdeployment %s status is equal not need update", req)
 		return nil
 	}
@@ -536,6 +687,10 @@ func (w *worker) stepUpdateStatus(ctx context.Context, req ktypes.NamespacedName
 		now := metav1.Now()
 		obj.Status.LastUpdateTime = &now
 		status.DeepCopyInto(&obj.Status.AggrStatus)
+		// resources are applied, clear the failure reported before
+		if cond := reconciledCondition(&obj.Status); cond != nil {
+			setAdvDeploymentCondition(&obj.Status, *cond)
+		}
 		// It is very useful for controller that support this field
 		// without this, you might trigger a sync as a result of updating your own status.
 		if generationEquanl {
@@ -554,7 +709,7 @@ func (w *worker) stepUpdateStatus(ctx context.Context, req ktypes.NamespacedName
 			klog.Errorf("Re-get advdeployment %s failed: %v", req, getErr)
 			return getErr
 		}
-		if obj.Status.ObservedGeneration == obj.ObjectMeta.Generation && equality.Semantic.DeepEqual(&obj.Status.AggrStatus, status) {
+		if obj.Status.ObservedGeneration == obj.ObjectMeta.Generation && equality.Semantic.DeepEqual(&obj.Status.AggrStatus, status) && reconciledCondition(&obj.Status) == nil {
 			// same status not need update
 			klog.V(3).Infof("Re-get advdeployment compare status is equal.")
 			return nil
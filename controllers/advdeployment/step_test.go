@@ -0,0 +1,122 @@
+package advdeployment
+
+import (
+	"context"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	symctx "github.com/symcn/sym-ops/pkg/context"
+	"github.com/symcn/sym-ops/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newStatusStatefulSet(name string) *appsv1.StatefulSet {
+	var replicas int32 = 1
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{types.ObserveMustLabelAppName: "app"}},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status:     appsv1.StatefulSetStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1},
+	}
+}
+
+func newStatusJob(name string) *batchv1.Job {
+	var completions int32 = 1
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{types.ObserveMustLabelAppName: "app"}},
+		Spec:       batchv1.JobSpec{Completions: &completions},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+}
+
+func newStatusConfigMap(name, app string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{types.ObserveMustLabelAppName: app}},
+	}
+}
+
+func TestStepRecalculateStatus(t *testing.T) {
+	args := []struct {
+		name          string
+		objs          []rtclient.Object
+		owners        []string
+		lastOwners    []string
+		expectKept    []rtclient.Object
+		expectDeleted []rtclient.Object
+		expectDesired int32
+	}{
+		{
+			name:          "statefulset",
+			objs:          []rtclient.Object{newStatusStatefulSet("app-blue")},
+			owners:        []string{"StatefulSet.apps:default/app-blue"},
+			expectKept:    []rtclient.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "app-blue"}}},
+			expectDesired: 1,
+		},
+		{
+			name:          "unused statefulset",
+			objs:          []rtclient.Object{newStatusStatefulSet("app-blue"), newStatusStatefulSet("app-green")},
+			owners:        []string{"StatefulSet.apps:default/app-blue"},
+			expectKept:    []rtclient.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "app-blue"}}},
+			expectDeleted: []rtclient.Object{&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "app-green"}}},
+			expectDesired: 1,
+		},
+		{
+			name:          "job",
+			objs:          []rtclient.Object{newStatusJob("app-migrate")},
+			owners:        []string{"Job.batch:default/app-migrate"},
+			expectKept:    []rtclient.Object{&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "app-migrate"}}},
+			expectDesired: 1,
+		},
+		{
+			name: "removed configmap",
+			objs: []rtclient.Object{
+				newStatusStatefulSet("app-blue"),
+				newStatusConfigMap("app-blue", "app"),
+				newStatusConfigMap("app-green", "app"),
+				newStatusConfigMap("app-red", "other"),
+			},
+			owners:        []string{"StatefulSet.apps:default/app-blue", "ConfigMap:default/app-blue"},
+			lastOwners:    []string{"StatefulSet.apps:default/app-blue", "ConfigMap:default/app-blue", "ConfigMap:default/app-green", "ConfigMap:default/app-red"},
+			expectKept:    []rtclient.Object{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-blue"}}, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-red"}}},
+			expectDeleted: []rtclient.Object{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "app-green"}}},
+			expectDesired: 1,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid-1"}}
+			adv.Status.AggrStatus.OwnerResource = arg.lastOwners
+			cli := newFakeMingleClient(arg.objs...)
+			w := &worker{currentCli: cli}
+			ctx := symctx.WithValue(context.TODO(), types.ContextKeyStepStop, false)
+			symctx.WithValue(ctx, types.ContextKeyAdvdeploymentOwnerRes, arg.owners)
+
+			if err := w.stepRecalculateStatus(ctx, ktypes.NamespacedName{Name: "app", Namespace: "default"}, adv); err != nil {
+				t.Fatalf("recalculate status failed: %v", err)
+			}
+			for _, obj := range arg.expectKept {
+				if err := cli.Get(ktypes.NamespacedName{Name: obj.GetName(), Namespace: "default"}, obj); err != nil {
+					t.Errorf("expect %s kept, but got %v", obj.GetName(), err)
+				}
+			}
+			for _, obj := range arg.expectDeleted {
+				if err := cli.Get(ktypes.NamespacedName{Name: obj.GetName(), Namespace: "default"}, obj); !apierrors.IsNotFound(err) {
+					t.Errorf("expect %s deleted, but got %v", obj.GetName(), err)
+				}
+			}
+			status, ok := symctx.GetValue(ctx, types.ContextKeyAdvdeploymentAggreStatus).(*workloadv1beta1.AdvDeploymentAggrStatus)
+			if !ok {
+				t.Fatalf("expect aggregated status")
+			}
+			if status.Desired != arg.expectDesired || status.Status != workloadv1beta1.AppStatusRuning {
+				t.Errorf("expect desired %d running, but got %d %s", arg.expectDesired, status.Desired, status.Status)
+			}
+		})
+	}
+}
@@ -2,8 +2,10 @@ package advdeployment
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/symcn/api"
 	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
 	"github.com/symcn/sym-ops/pkg/resource"
 	"github.com/symcn/sym-ops/pkg/types"
 	"github.com/symcn/sym-ops/pkg/utils"
@@ -23,14 +26,22 @@ import (
 	kresource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 var (
 	requeueAfterTime = 5 * time.Second
 	convertFactory   = map[string]convert{}
+
+	// the group kinds of workloads in owner resources
+	deploymentGroupKind  = schema.GroupKind{Group: appsv1.GroupName, Kind: types.DeploymentKind}.String()
+	statefulSetGroupKind = schema.GroupKind{Group: appsv1.GroupName, Kind: types.StatefulSetKind}.String()
+	jobGroupKind         = schema.GroupKind{Group: batchv1.GroupName, Kind: types.JobKind}.String()
 )
 
 type step func(ctx context.Context, req ktypes.NamespacedName, app *workloadv1beta1.AdvDeployment) error
@@ -106,30 +117,133 @@ func requeue(obj rtclient.Object, queue api.WorkQueue) {
 	})
 }
 
-func getCharInfo(podSet *workloadv1beta1.PodSet, adv *workloadv1beta1.AdvDeployment) (chartURL, chartVersion string, rawChart []byte) {
-	if podSet.Chart != nil {
-		if podSet.Chart.RawChart != nil {
-			rawChart = *podSet.Chart.RawChart
+// getChartSpec returns the podSet chart spec, the global one is used if it is empty
+func getChartSpec(podSet *workloadv1beta1.PodSet, adv *workloadv1beta1.AdvDeployment) *workloadv1beta1.ChartSpec {
+	if chart := podSet.Chart; chart != nil {
+		if chart.RawChart != nil || chart.ChartFrom != nil || chart.RawManifests != "" ||
+			(chart.CharURL != nil && (chart.CharURL.URL != "" || chart.CharURL.ChartVersion != "")) {
+			return chart
 		}
-		if podSet.Chart.CharURL != nil {
-			chartURL = podSet.Chart.CharURL.URL
-			chartVersion = podSet.Chart.CharURL.ChartVersion
+	}
+	return adv.Spec.PodSpec.Chart
+}
+
+// getChart returns the chart package of podSet, rawChart takes precedence over chartFrom,
+// and chartFrom takes precedence over chart url
+func (w *worker) getChart(podSet *workloadv1beta1.PodSet, adv *workloadv1beta1.AdvDeployment) ([]byte, error) {
+	chart := getChartSpec(podSet, adv)
+	if chart == nil {
+		return nil, nil
+	}
+	if chart.RawChart != nil && len(*chart.RawChart) > 0 {
+		return *chart.RawChart, nil
+	}
+
+	if chart.ChartFrom != nil {
+		data, err := utils.GetReferencedData(w.currentCli.GetKubeInterface(), adv.Namespace, chart.ChartFrom, utils.DefaultChartKey)
+		if err != nil {
+			return nil, fmt.Errorf("PodSet %s get chart failed: %v", podSet.Name, err)
 		}
+		return data, nil
+	}
 
-		// if podset char info is empty, use global char into
-		if rawChart != nil || chartURL != "" || chartVersion != "" {
-			return
+	chartURL := chart.CharURL
+	if chartURL == nil || chartURL.URL == "" {
+		return nil, nil
+	}
+	cred, err := w.getChartCredentials(chartURL, adv.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("PodSet %s get chart %s credentials failed: %v", podSet.Name, chartURL.URL, err)
+	}
+	data, err := w.chartFetcher.FetchWithCredentials(chartURL.URL, chartURL.ChartVersion, cred)
+	if err != nil {
+		return nil, fmt.Errorf("PodSet %s fetch chart %s version %s failed: %v", podSet.Name, chartURL.URL, chartURL.ChartVersion, err)
+	}
+	return data, nil
+}
+
+// getValuesFrom returns the values files referenced by podSet valuesFrom in order
+func (w *worker) getValuesFrom(podSet *workloadv1beta1.PodSet, namespace string) ([]string, error) {
+	values := make([]string, 0, len(podSet.ValuesFrom))
+	for _, selector := range podSet.ValuesFrom {
+		if selector == nil {
+			continue
 		}
+		data, err := utils.GetReferencedData(w.currentCli.GetKubeInterface(), namespace, selector, utils.DefaultValuesKey)
+		if err != nil {
+			return nil, fmt.Errorf("PodSet %s get valuesFrom failed: %v", podSet.Name, err)
+		}
+		values = append(values, string(data))
 	}
+	return values, nil
+}
 
-	if adv.Spec.PodSpec.Chart.RawChart != nil {
-		rawChart = *adv.Spec.PodSpec.Chart.RawChart
+// getChartCredentials read the credentials Secret in the AdvDeployment namespace, the Secret is
+// read from apiserver directly rather than watching all Secrets.
+func (w *worker) getChartCredentials(chartURL *workloadv1beta1.ChartURL, namespace string) (*helm.Credentials, error) {
+	if chartURL.SecretName == "" {
+		return nil, nil
 	}
-	if adv.Spec.PodSpec.Chart.CharURL != nil {
-		chartURL = adv.Spec.PodSpec.Chart.CharURL.URL
-		chartVersion = adv.Spec.PodSpec.Chart.CharURL.ChartVersion
+	secret, err := w.currentCli.GetKubeInterface().CoreV1().Secrets(namespace).Get(context.TODO(), chartURL.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get Secret %s/%s failed: %v", namespace, chartURL.SecretName, err)
 	}
-	return
+	return parseChartCredentials(secret, chartURL.URL)
+}
+
+// parseChartCredentials returns the credentials of basic auth Secret, or the auth of the chart
+// url host in dockerconfigjson Secret.
+func parseChartCredentials(secret *corev1.Secret, chartURL string) (*helm.Credentials, error) {
+	if username, ok := secret.Data[corev1.BasicAuthUsernameKey]; ok {
+		return &helm.Credentials{
+			Username: string(username),
+			Password: string(secret.Data[corev1.BasicAuthPasswordKey]),
+		}, nil
+	}
+
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s/%s has neither %s nor %s", secret.Namespace, secret.Name, corev1.BasicAuthUsernameKey, corev1.DockerConfigJsonKey)
+	}
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return nil, err
+	}
+	config := &struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err = json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parse Secret %s/%s %s failed: %v", secret.Namespace, secret.Name, corev1.DockerConfigJsonKey, err)
+	}
+	auth, ok := config.Auths[u.Host]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s/%s has no auth of %s", secret.Namespace, secret.Name, u.Host)
+	}
+	if auth.Username == "" && auth.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("decode Secret %s/%s auth of %s failed: %v", secret.Namespace, secret.Name, u.Host, err)
+		}
+		pair := strings.SplitN(string(decoded), ":", 2)
+		auth.Username = pair[0]
+		if len(pair) == 2 {
+			auth.Password = pair[1]
+		}
+	}
+	return &helm.Credentials{Username: auth.Username, Password: auth.Password}, nil
+}
+
+// getLookupConfig returns the rest config of the chart lookup function, which reads the member
+// cluster and is limited to namespace unless LookupAllNamespaces is set.
+func (w *worker) getLookupConfig(namespace string) *rest.Config {
+	if w.conf.LookupAllNamespaces {
+		namespace = ""
+	}
+	return helm.NewLookupConfig(w.currentCli.GetKubeRestConfig(), namespace)
 }
 
 type hpaSpec struct {
@@ -153,8 +267,35 @@ func getHpaSpecEnable(m map[string]string) bool {
 	return hs.Enable
 }
 
-func getFormattedName(kind string, obj rtclient.Object) string {
-	return fmt.Sprintf("%s:%s/%s", kind, obj.GetNamespace(), obj.GetName())
+// getFormattedName returns <groupKind>:<namespace>/<name>, groupKind is <kind>.<group> or <kind>
+// of the core group
+func getFormattedName(groupKind string, obj rtclient.Object) string {
+	return fmt.Sprintf("%s:%s/%s", groupKind, obj.GetNamespace(), obj.GetName())
+}
+
+// parseFormattedName parse the name formatted by getFormattedName
+func parseFormattedName(name string) (schema.GroupKind, ktypes.NamespacedName, bool) {
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return schema.GroupKind{}, ktypes.NamespacedName{}, false
+	}
+	j := strings.LastIndex(name, "/")
+	if j < i {
+		return schema.GroupKind{}, ktypes.NamespacedName{}, false
+	}
+	return schema.ParseGroupKind(name[:i]), ktypes.NamespacedName{Namespace: name[i+1 : j], Name: name[j+1:]}, true
+}
+
+// getObjectKind returns the kind of obj, typed objects from List have empty TypeMeta, look up the scheme
+func getObjectKind(obj rtclient.Object) string {
+	if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		return kind
+	}
+	gvk, err := apiutil.GVKForObject(obj, types.Scheme)
+	if err != nil {
+		return ""
+	}
+	return gvk.Kind
 }
 
 func (w *worker) convertToSvc(obj *unstructured.Unstructured, isHpaEnable bool) (rtclient.Object, resource.Option, int32, error) {
@@ -223,6 +364,10 @@ func (w *worker) convertToJob(obj *unstructured.Unstructured, isHpaEnable bool)
 	return job, resource.Option{IsRecreate: w.conf.Debug, IsIgnoreReplicas: false}, 0, nil
 }
 
+func (w *worker) convertToUnstructured(obj *unstructured.Unstructured, isHpaEnable bool) (rtclient.Object, resource.Option, int32, error) {
+	return obj.DeepCopy(), resource.Option{IsRecreate: w.conf.Debug}, 0, nil
+}
+
 func parseMetrics(annotations map[string]string, objectName string) []v2beta2.MetricSpec {
 	metricsSlice := getHpaMetrics(annotations)
 	if len(metricsSlice) == 0 {
@@ -347,13 +492,13 @@ func removeDuplicatedVersion(list []*workloadv1beta1.PodSetStatusInfo) string {
 	return strings.Join(versions, types.VersionSep)
 }
 
-func isUnunseObject(kind string, obj rtclient.Object, owners []string) bool {
+func isUnunseObject(groupKind string, obj rtclient.Object, owners []string) bool {
 	if len(owners) == 0 {
 		// if owners is empty, shouldn't mark unused
 		return false
 	}
 
-	name := getFormattedName(kind, obj)
+	name := getFormattedName(groupKind, obj)
 	for _, item := range owners {
 		if name == item {
 			return false
@@ -0,0 +1,121 @@
+package advdeployment
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGetChartSpec(t *testing.T) {
+	rawChart := []byte("chart")
+	advChart := &workloadv1beta1.ChartSpec{
+		CharURL: &workloadv1beta1.ChartURL{URL: "oci://registry.example.com/charts/app", ChartVersion: "1.0.0", SecretName: "registry"},
+	}
+	urlChart := &workloadv1beta1.ChartSpec{CharURL: &workloadv1beta1.ChartURL{URL: "https://charts.example.com/app", ChartVersion: "2.0.0"}}
+	rawPodSetChart := &workloadv1beta1.ChartSpec{RawChart: &rawChart}
+	fromChart := &workloadv1beta1.ChartSpec{ChartFrom: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-chart"}}
+
+	adv := &workloadv1beta1.AdvDeployment{}
+	adv.Spec.PodSpec.Chart = advChart
+
+	args := []struct {
+		name   string
+		podSet *workloadv1beta1.PodSet
+		expect *workloadv1beta1.ChartSpec
+	}{
+		{
+			name:   "use global chart",
+			podSet: &workloadv1beta1.PodSet{Name: "blue"},
+			expect: advChart,
+		},
+		{
+			name:   "empty podSet chart url",
+			podSet: &workloadv1beta1.PodSet{Name: "blue", Chart: &workloadv1beta1.ChartSpec{CharURL: &workloadv1beta1.ChartURL{}}},
+			expect: advChart,
+		},
+		{
+			name:   "podSet chart url",
+			podSet: &workloadv1beta1.PodSet{Name: "blue", Chart: urlChart},
+			expect: urlChart,
+		},
+		{
+			name:   "podSet raw chart",
+			podSet: &workloadv1beta1.PodSet{Name: "blue", Chart: rawPodSetChart},
+			expect: rawPodSetChart,
+		},
+		{
+			name:   "podSet chart from",
+			podSet: &workloadv1beta1.PodSet{Name: "blue", Chart: fromChart},
+			expect: fromChart,
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			if chart := getChartSpec(arg.podSet, adv); chart != arg.expect {
+				t.Errorf("expect chart %v, but got %v", arg.expect, chart)
+			}
+		})
+	}
+}
+
+func TestParseChartCredentials(t *testing.T) {
+	dockerConfig := []byte(`{"auths":{
+		"registry.example.com":{"username":"user","password":"pass"},
+		"harbor.example.com":{"auth":"cm9ib3Q6c2VjcmV0OmtleQ=="}
+	}}`)
+
+	args := []struct {
+		name     string
+		data     map[string][]byte
+		chartURL string
+		expect   *helm.Credentials
+		wantErr  bool
+	}{
+		{
+			name:     "basic auth",
+			data:     map[string][]byte{corev1.BasicAuthUsernameKey: []byte("user"), corev1.BasicAuthPasswordKey: []byte("pass")},
+			chartURL: "https://charts.example.com/app",
+			expect:   &helm.Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name:     "dockerconfigjson username and password",
+			data:     map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig},
+			chartURL: "oci://registry.example.com/charts/app",
+			expect:   &helm.Credentials{Username: "user", Password: "pass"},
+		},
+		{
+			name:     "dockerconfigjson auth",
+			data:     map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig},
+			chartURL: "oci://harbor.example.com/charts/app",
+			expect:   &helm.Credentials{Username: "robot", Password: "secret:key"},
+		},
+		{
+			name:     "dockerconfigjson without host",
+			data:     map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig},
+			chartURL: "oci://other.example.com/charts/app",
+			wantErr:  true,
+		},
+		{
+			name:     "no credentials",
+			data:     map[string][]byte{"token": []byte("token")},
+			chartURL: "oci://registry.example.com/charts/app",
+			wantErr:  true,
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			secret := &corev1.Secret{Data: arg.data}
+			secret.Name, secret.Namespace = "registry", "default"
+			cred, err := parseChartCredentials(secret, arg.chartURL)
+			if (err != nil) != arg.wantErr {
+				t.Fatalf("expect error %v, but got %v", arg.wantErr, err)
+			}
+			if !reflect.DeepEqual(cred, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, cred)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package advdeployment
+
+import (
+	"fmt"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	"github.com/symcn/sym-ops/pkg/types"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// buildPodSetValues build helm values of the podSet, the podSet rawValues is merged over
+// valuesFrom which are merged in order, and all of them are merged over the sym values:
+//
+//	sym:
+//	  replicas: 3          # resolved podSet replicas, absent if nil
+//	  podSetName: blue
+//	  podSetMeta: {}       # podSet meta
+//	  clusterName: gz01    # absent if unknown
+//	  zone: gz             # absent if unknown
+//
+// the keys defined in rawValues take precedence. The nulls are kept so they still remove the chart
+// defaults. The sym values are not validated by the chart schema.
+func buildPodSetValues(adv *workloadv1beta1.AdvDeployment, podSet *workloadv1beta1.PodSet, valuesFrom []string) (string, error) {
+	vals := map[string]interface{}{}
+	for i, from := range valuesFrom {
+		v, err := chartutil.ReadValues([]byte(from))
+		if err != nil {
+			return "", fmt.Errorf("read podSet %s valuesFrom[%d] failed: %v", podSet.Name, i, err)
+		}
+		vals = helm.MergeValues(vals, v.AsMap())
+	}
+	raw, err := chartutil.ReadValues([]byte(podSet.RawValues))
+	if err != nil {
+		return "", fmt.Errorf("read podSet %s rawValues failed: %v", podSet.Name, err)
+	}
+	vals = helm.MergeValues(vals, raw.AsMap())
+
+	sym := map[string]interface{}{
+		"podSetName": podSet.Name,
+		"podSetMeta": map[string]interface{}{},
+	}
+	for k, v := range podSet.Mata {
+		sym["podSetMeta"].(map[string]interface{})[k] = v
+	}
+	replicas, err := resolvePodSetReplicas(adv, podSet)
+	if err != nil {
+		return "", err
+	}
+	if replicas != nil {
+		sym["replicas"] = int(*replicas)
+	}
+	if v := adv.Labels[types.ObserveMustLabelClusterName]; v != "" {
+		sym["clusterName"] = v
+	}
+	if v := adv.Labels[types.LabelKeyZone]; v != "" {
+		sym["zone"] = v
+	}
+
+	merged := chartutil.CoalesceTables(vals, map[string]interface{}{helm.SymValuesKey: sym})
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("marshal podSet %s values failed: %v", podSet.Name, err)
+	}
+	return string(out), nil
+}
+
+// resolvePodSetReplicas returns the podSet replicas, the percentage is scaled with the adv
+// replicas. nil means the podSet replicas is not specified.
+func resolvePodSetReplicas(adv *workloadv1beta1.AdvDeployment, podSet *workloadv1beta1.PodSet) (*int32, error) {
+	if podSet.Replicas == nil {
+		return nil, nil
+	}
+	var total int
+	if adv.Spec.Replicas != nil {
+		total = int(*adv.Spec.Replicas)
+	}
+	replicas, err := intstr.GetScaledValueFromIntOrPercent(podSet.Replicas, total, true)
+	if err != nil {
+		return nil, fmt.Errorf("resolve podSet %s replicas failed: %v", podSet.Name, err)
+	}
+	r := int32(replicas)
+	return &r, nil
+}
@@ -0,0 +1,128 @@
+package advdeployment
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+func TestBuildPodSetValues(t *testing.T) {
+	var replicas int32 = 10
+	adv := &workloadv1beta1.AdvDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app",
+			Labels: map[string]string{
+				types.ObserveMustLabelClusterName: "gz01",
+				types.LabelKeyZone:                "gz",
+			},
+		},
+	}
+	adv.Spec.Replicas = &replicas
+	fixed := intstr.FromInt(3)
+	percent := intstr.FromString("25%")
+
+	args := []struct {
+		name       string
+		podSet     *workloadv1beta1.PodSet
+		valuesFrom []string
+		expect     map[string]interface{}
+	}{
+		{
+			name:   "empty rawValues",
+			podSet: &workloadv1beta1.PodSet{Name: "blue", Replicas: &fixed, Mata: map[string]string{"color": "blue"}},
+			expect: map[string]interface{}{
+				"sym": map[string]interface{}{
+					"replicas":    float64(3),
+					"podSetName":  "blue",
+					"podSetMeta":  map[string]interface{}{"color": "blue"},
+					"clusterName": "gz01",
+					"zone":        "gz",
+				},
+			},
+		},
+		{
+			name:   "percentage replicas and rawValues",
+			podSet: &workloadv1beta1.PodSet{Name: "green", Replicas: &percent, RawValues: "image: app\n"},
+			expect: map[string]interface{}{
+				"image": "app",
+				"sym": map[string]interface{}{
+					"replicas":    float64(3),
+					"podSetName":  "green",
+					"podSetMeta":  map[string]interface{}{},
+					"clusterName": "gz01",
+					"zone":        "gz",
+				},
+			},
+		},
+		{
+			name:   "rawValues take precedence",
+			podSet: &workloadv1beta1.PodSet{Name: "blue", RawValues: "sym:\n  zone: rz\n"},
+			expect: map[string]interface{}{
+				"sym": map[string]interface{}{
+					"podSetName":  "blue",
+					"podSetMeta":  map[string]interface{}{},
+					"clusterName": "gz01",
+					"zone":        "rz",
+				},
+			},
+		},
+		{
+			name:       "valuesFrom in order",
+			podSet:     &workloadv1beta1.PodSet{Name: "blue", RawValues: "image: app\n"},
+			valuesFrom: []string{"image: base\nport: 80\nenv:\n  a: 1\n", "port: 8080\nenv:\n  b: 2\n"},
+			expect: map[string]interface{}{
+				"image": "app",
+				"port":  float64(8080),
+				"env":   map[string]interface{}{"a": float64(1), "b": float64(2)},
+				"sym": map[string]interface{}{
+					"podSetName":  "blue",
+					"podSetMeta":  map[string]interface{}{},
+					"clusterName": "gz01",
+					"zone":        "gz",
+				},
+			},
+		},
+		{
+			name:       "nulls are kept",
+			podSet:     &workloadv1beta1.PodSet{Name: "blue", RawValues: "port: null\nenv:\n  a: null\n"},
+			valuesFrom: []string{"port: 80\nenv:\n  a: 1\n  b: 2\n"},
+			expect: map[string]interface{}{
+				"port": nil,
+				"env":  map[string]interface{}{"a": nil, "b": float64(2)},
+				"sym": map[string]interface{}{
+					"podSetName":  "blue",
+					"podSetMeta":  map[string]interface{}{},
+					"clusterName": "gz01",
+					"zone":        "gz",
+				},
+			},
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			values, err := buildPodSetValues(adv, arg.podSet, arg.valuesFrom)
+			if err != nil {
+				t.Fatalf("build values failed: %v", err)
+			}
+			got := map[string]interface{}{}
+			if err = yaml.Unmarshal([]byte(values), &got); err != nil {
+				t.Fatalf("unmarshal values failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+
+	if _, err := buildPodSetValues(adv, &workloadv1beta1.PodSet{Name: "blue", RawValues: "a: [b"}, nil); err == nil {
+		t.Error("invalid rawValues should return error")
+	}
+	if _, err := buildPodSetValues(adv, &workloadv1beta1.PodSet{Name: "blue"}, []string{"a: [b"}); err == nil {
+		t.Error("invalid valuesFrom should return error")
+	}
+}
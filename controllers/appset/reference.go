@@ -0,0 +1,210 @@
+package appset
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/symcn/api"
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	"github.com/symcn/sym-ops/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// referencedObjects returns the ConfigMaps and Secrets referenced by chartFrom, valuesFrom and
+// the chartUrl credentials of adv, deduplicated by kind and name
+func referencedObjects(adv *workloadv1beta1.AdvDeployment) []*workloadv1beta1.ResourceKeySelector {
+	var (
+		refs []*workloadv1beta1.ResourceKeySelector
+		seen = map[string]struct{}{}
+	)
+	add := func(selector *workloadv1beta1.ResourceKeySelector) {
+		if selector == nil {
+			return
+		}
+		key := selector.Kind + "/" + selector.Name
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		refs = append(refs, selector)
+	}
+	addChart := func(chart *workloadv1beta1.ChartSpec) {
+		if chart == nil {
+			return
+		}
+		add(chart.ChartFrom)
+		if chart.CharURL != nil && chart.CharURL.SecretName != "" {
+			add(&workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: chart.CharURL.SecretName})
+		}
+	}
+
+	addChart(adv.Spec.PodSpec.Chart)
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		if podSet == nil {
+			continue
+		}
+		addChart(podSet.Chart)
+		for _, selector := range podSet.ValuesFrom {
+			add(selector)
+		}
+	}
+	return refs
+}
+
+// applyReferencedObjects copy the ConfigMaps and Secrets referenced by adv from master to the
+// target cluster before adv is applied, so the worker is able to resolve them. The copies are
+// owned by the target AdvDeployment once it exists, so they are garbage collected with it.
+// owned reports whether the owner is set on the copies.
+func (m *master) applyReferencedObjects(cli api.MingleClient, req ktypes.NamespacedName, adv *workloadv1beta1.AdvDeployment) (owned bool, err error) {
+	refs := referencedObjects(adv)
+	if len(refs) == 0 {
+		return true, nil
+	}
+
+	var owner *metav1.OwnerReference
+	old := &workloadv1beta1.AdvDeployment{}
+	err = cli.Get(req, old)
+	if err == nil {
+		owner = &metav1.OwnerReference{
+			APIVersion: workloadv1beta1.GroupVersion.String(),
+			Kind:       "AdvDeployment",
+			Name:       old.Name,
+			UID:        old.UID,
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("Get %s Advdeployment %s failed: %v", cli.GetClusterCfgInfo().GetName(), req, err)
+	}
+
+	for _, selector := range refs {
+		src, err := utils.GetReferencedObject(m.currentCli.GetKubeInterface(), req.Namespace, selector)
+		if err != nil {
+			return false, fmt.Errorf("Get master %s %s/%s failed: %v", selector.Kind, req.Namespace, selector.Name, err)
+		}
+
+		switch o := src.(type) {
+		case *corev1.ConfigMap:
+			err = applyCopiedConfigMap(cli.GetKubeInterface(), o, owner)
+		case *corev1.Secret:
+			err = applyCopiedSecret(cli.GetKubeInterface(), o, owner)
+		}
+		if err != nil {
+			return false, fmt.Errorf("Copy %s %s/%s to cluster %s failed: %v", selector.Kind, req.Namespace, selector.Name, cli.GetClusterCfgInfo().GetName(), err)
+		}
+	}
+	return owner != nil, nil
+}
+
+func applyCopiedConfigMap(kubeCli kubernetes.Interface, src *corev1.ConfigMap, owner *metav1.OwnerReference) error {
+	desired := newCopiedObjectMeta(src, owner)
+	configMaps := kubeCli.CoreV1().ConfigMaps(src.Namespace)
+
+	old, err := configMaps.Get(context.TODO(), src.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: desired,
+			Data:       src.Data,
+			BinaryData: src.BinaryData,
+		}, metav1.CreateOptions{})
+		if err == nil {
+			klog.V(4).Infof("Create copied ConfigMap %s/%s successfully", src.Namespace, src.Name)
+		}
+		return err
+	}
+
+	new := old.DeepCopy()
+	if err = mergeCopiedObjectMeta(new, desired); err != nil {
+		return err
+	}
+	new.Data = src.Data
+	new.BinaryData = src.BinaryData
+	if equality.Semantic.DeepEqual(old, new) {
+		return nil
+	}
+	_, err = configMaps.Update(context.TODO(), new, metav1.UpdateOptions{})
+	if err == nil {
+		klog.V(4).Infof("Update copied ConfigMap %s/%s successfully", src.Namespace, src.Name)
+	}
+	return err
+}
+
+func applyCopiedSecret(kubeCli kubernetes.Interface, src *corev1.Secret, owner *metav1.OwnerReference) error {
+	desired := newCopiedObjectMeta(src, owner)
+	secrets := kubeCli.CoreV1().Secrets(src.Namespace)
+
+	old, err := secrets.Get(context.TODO(), src.Name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err = secrets.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: desired,
+			Type:       src.Type,
+			Data:       src.Data,
+		}, metav1.CreateOptions{})
+		if err == nil {
+			klog.V(4).Infof("Create copied Secret %s/%s successfully", src.Namespace, src.Name)
+		}
+		return err
+	}
+
+	new := old.DeepCopy()
+	if err = mergeCopiedObjectMeta(new, desired); err != nil {
+		return err
+	}
+	new.Data = src.Data
+	if equality.Semantic.DeepEqual(old, new) {
+		return nil
+	}
+	_, err = secrets.Update(context.TODO(), new, metav1.UpdateOptions{})
+	if err == nil {
+		klog.V(4).Infof("Update copied Secret %s/%s successfully", src.Namespace, src.Name)
+	}
+	return err
+}
+
+func newCopiedObjectMeta(src metav1.Object, owner *metav1.OwnerReference) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{
+		Name:      src.GetName(),
+		Namespace: src.GetNamespace(),
+		Labels:    utils.MergeMap(src.GetLabels(), map[string]string{types.LabelKeyCopiedFromMaster: "true"}),
+	}
+	if owner != nil {
+		meta.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return meta
+}
+
+// mergeCopiedObjectMeta merge desired meta into the existing copy, the owners of the other
+// AdvDeployments sharing it are kept. The objects not copied from master are never overwritten.
+func mergeCopiedObjectMeta(existing metav1.Object, desired metav1.ObjectMeta) error {
+	if existing.GetLabels()[types.LabelKeyCopiedFromMaster] != "true" {
+		return fmt.Errorf("%s/%s already exists and is not copied from master", existing.GetNamespace(), existing.GetName())
+	}
+	existing.SetLabels(desired.Labels)
+
+	owners := existing.GetOwnerReferences()
+	for _, owner := range desired.OwnerReferences {
+		found := false
+		for _, o := range owners {
+			if o.UID == owner.UID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			owners = append(owners, owner)
+		}
+	}
+	existing.SetOwnerReferences(owners)
+	return nil
+}
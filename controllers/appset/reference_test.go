@@ -0,0 +1,251 @@
+package appset
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/symcn/api"
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	rtfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeMingleClient is the MingleClient of a fake cluster, the methods not overridden panic
+type fakeMingleClient struct {
+	api.MingleClient
+	name    string
+	cli     rtclient.Client
+	kubeCli kubernetes.Interface
+}
+
+type fakeClusterCfgInfo struct {
+	api.ClusterCfgInfo
+	name string
+}
+
+func (f *fakeClusterCfgInfo) GetName() string {
+	return f.name
+}
+
+func newFakeMingleClient(name string, kubeObjects ...runtime.Object) *fakeMingleClient {
+	scheme := runtime.NewScheme()
+	_ = workloadv1beta1.AddToScheme(scheme)
+	return &fakeMingleClient{
+		name:    name,
+		cli:     rtfake.NewClientBuilder().WithScheme(scheme).Build(),
+		kubeCli: fake.NewSimpleClientset(kubeObjects...),
+	}
+}
+
+func (f *fakeMingleClient) GetClusterCfgInfo() api.ClusterCfgInfo {
+	return &fakeClusterCfgInfo{name: f.name}
+}
+
+func (f *fakeMingleClient) GetKubeInterface() kubernetes.Interface {
+	return f.kubeCli
+}
+
+func (f *fakeMingleClient) Get(key ktypes.NamespacedName, obj rtclient.Object) error {
+	return f.cli.Get(context.TODO(), key, obj)
+}
+
+// Create sets the uid like the apiserver does
+func (f *fakeMingleClient) Create(obj rtclient.Object, opts ...rtclient.CreateOption) error {
+	if obj.GetUID() == "" {
+		obj.SetUID(ktypes.UID(obj.GetNamespace() + "-" + obj.GetName() + "-uid"))
+	}
+	return f.cli.Create(context.TODO(), obj, opts...)
+}
+
+func TestReferencedObjects(t *testing.T) {
+	chartFrom := &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-chart"}
+	values := &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-values"}
+	secretValues := &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: "app-values"}
+
+	repoSecret := &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: "repo-auth"}
+	registrySecret := &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: "registry-auth"}
+
+	adv := &workloadv1beta1.AdvDeployment{}
+	adv.Spec.PodSpec.Chart = &workloadv1beta1.ChartSpec{ChartFrom: chartFrom}
+	adv.Spec.Topology.PodSets = []*workloadv1beta1.PodSet{
+		{Name: "blue", ValuesFrom: []*workloadv1beta1.ResourceKeySelector{values, secretValues}},
+		{Name: "green", Chart: &workloadv1beta1.ChartSpec{ChartFrom: chartFrom}, ValuesFrom: []*workloadv1beta1.ResourceKeySelector{
+			{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-values", Key: "green.yaml"},
+		}},
+		nil,
+	}
+
+	expect := []*workloadv1beta1.ResourceKeySelector{chartFrom, values, secretValues}
+	if refs := referencedObjects(adv); !reflect.DeepEqual(refs, expect) {
+		t.Errorf("expect %v, but got %v", expect, refs)
+	}
+
+	// the credentials Secret of chartUrl
+	adv.Spec.PodSpec.Chart = &workloadv1beta1.ChartSpec{CharURL: &workloadv1beta1.ChartURL{URL: "https://charts.example.com/app", SecretName: "repo-auth"}}
+	adv.Spec.Topology.PodSets = []*workloadv1beta1.PodSet{
+		{Name: "blue", Chart: &workloadv1beta1.ChartSpec{CharURL: &workloadv1beta1.ChartURL{URL: "oci://registry.example.com/charts/app", SecretName: "registry-auth"}}},
+		{Name: "green", Chart: &workloadv1beta1.ChartSpec{CharURL: &workloadv1beta1.ChartURL{URL: "https://charts.example.com/app", SecretName: "repo-auth"}}},
+		{Name: "red", Chart: &workloadv1beta1.ChartSpec{CharURL: &workloadv1beta1.ChartURL{URL: "https://public.example.com/app"}}},
+	}
+	expect = []*workloadv1beta1.ResourceKeySelector{repoSecret, registrySecret}
+	if refs := referencedObjects(adv); !reflect.DeepEqual(refs, expect) {
+		t.Errorf("expect %v, but got %v", expect, refs)
+	}
+}
+
+func TestApplyCopiedConfigMap(t *testing.T) {
+	src := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-chart", Namespace: "default", Labels: map[string]string{"app": "app"}},
+		BinaryData: map[string][]byte{"chart.tgz": []byte("chart")},
+	}
+	owner := &metav1.OwnerReference{APIVersion: "workload.dmall.com/v1beta1", Kind: "AdvDeployment", Name: "app", UID: "uid-1"}
+	otherOwner := metav1.OwnerReference{APIVersion: "workload.dmall.com/v1beta1", Kind: "AdvDeployment", Name: "other", UID: "uid-2"}
+
+	args := []struct {
+		name        string
+		existing    *corev1.ConfigMap
+		owner       *metav1.OwnerReference
+		expectOwner []metav1.OwnerReference
+		wantErr     bool
+	}{
+		{
+			name:  "create without owner",
+			owner: nil,
+		},
+		{
+			name:        "create with owner",
+			owner:       owner,
+			expectOwner: []metav1.OwnerReference{*owner},
+		},
+		{
+			name: "update and keep other owners",
+			existing: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "app-chart",
+					Namespace:       "default",
+					Labels:          map[string]string{types.LabelKeyCopiedFromMaster: "true"},
+					OwnerReferences: []metav1.OwnerReference{otherOwner},
+				},
+				BinaryData: map[string][]byte{"chart.tgz": []byte("old")},
+			},
+			owner:       owner,
+			expectOwner: []metav1.OwnerReference{otherOwner, *owner},
+		},
+		{
+			name: "not copied from master",
+			existing: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "app-chart", Namespace: "default"},
+			},
+			owner:   owner,
+			wantErr: true,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			kubeCli := fake.NewSimpleClientset()
+			if arg.existing != nil {
+				kubeCli = fake.NewSimpleClientset(arg.existing)
+			}
+
+			err := applyCopiedConfigMap(kubeCli, src, arg.owner)
+			if (err != nil) != arg.wantErr {
+				t.Fatalf("expect error %v, but got %v", arg.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			cm, err := kubeCli.CoreV1().ConfigMaps("default").Get(context.TODO(), "app-chart", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("get configmap failed: %v", err)
+			}
+			if !reflect.DeepEqual(cm.BinaryData, src.BinaryData) {
+				t.Errorf("expect data %v, but got %v", src.BinaryData, cm.BinaryData)
+			}
+			if cm.Labels[types.LabelKeyCopiedFromMaster] != "true" || cm.Labels["app"] != "app" {
+				t.Errorf("expect copied and source labels, but got %v", cm.Labels)
+			}
+			if !reflect.DeepEqual(cm.OwnerReferences, arg.expectOwner) {
+				t.Errorf("expect owners %v, but got %v", arg.expectOwner, cm.OwnerReferences)
+			}
+		})
+	}
+}
+
+func TestApplyCopiedSecret(t *testing.T) {
+	src := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-values", Namespace: "default"},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"values.yaml": []byte("password: new")},
+	}
+	kubeCli := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-values",
+			Namespace: "default",
+			Labels:    map[string]string{types.LabelKeyCopiedFromMaster: "true"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"values.yaml": []byte("password: old")},
+	})
+
+	if err := applyCopiedSecret(kubeCli, src, nil); err != nil {
+		t.Fatalf("apply secret failed: %v", err)
+	}
+	secret, err := kubeCli.CoreV1().Secrets("default").Get(context.TODO(), "app-values", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret failed: %v", err)
+	}
+	if !reflect.DeepEqual(secret.Data, src.Data) {
+		t.Errorf("expect data %v, but got %v", src.Data, secret.Data)
+	}
+}
+
+func TestApplyAdvdeploymentWithReferencesFirstReconcile(t *testing.T) {
+	src := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-chart", Namespace: "default"},
+		BinaryData: map[string][]byte{"chart.tgz": []byte("chart")},
+	}
+	m := &master{currentCli: newFakeMingleClient("master", src)}
+	cli := newFakeMingleClient("member")
+
+	req := ktypes.NamespacedName{Namespace: "default", Name: "app"}
+	adv := &workloadv1beta1.AdvDeployment{ObjectMeta: metav1.ObjectMeta{Namespace: req.Namespace, Name: req.Name}}
+	adv.Spec.PodSpec.Chart = &workloadv1beta1.ChartSpec{
+		ChartFrom: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-chart"},
+	}
+
+	isChanged, err := m.applyAdvdeploymentWithReferences(cli, req, adv)
+	if err != nil {
+		t.Fatalf("apply advdeployment failed: %v", err)
+	}
+	if !isChanged {
+		t.Errorf("expect changed when the advdeployment is created")
+	}
+
+	created := &workloadv1beta1.AdvDeployment{}
+	if err = cli.Get(req, created); err != nil {
+		t.Fatalf("get advdeployment failed: %v", err)
+	}
+	cm, err := cli.GetKubeInterface().CoreV1().ConfigMaps("default").Get(context.TODO(), "app-chart", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get copied configmap failed: %v", err)
+	}
+	expect := []metav1.OwnerReference{{
+		APIVersion: workloadv1beta1.GroupVersion.String(),
+		Kind:       "AdvDeployment",
+		Name:       created.Name,
+		UID:        created.UID,
+	}}
+	if !reflect.DeepEqual(cm.OwnerReferences, expect) {
+		t.Errorf("expect owners %v, but got %v", expect, cm.OwnerReferences)
+	}
+}
@@ -0,0 +1,209 @@
+package appset
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// resolvePodSetReplicas resolves replicas of all podSets across all target clusters, the result
+// is ordered as spec.clusterTopology.
+//  1. integer replicas is used as it is
+//  2. percentage replicas is resolved against spec.replicas, all percentage podSets share
+//     round(spec.replicas * sum(percentage)) pods which is distributed with the largest remainder
+//     method, so the total is exact and the result is deterministic. If the fixed podSets already
+//     take most of spec.replicas, the percentage podSets share what is left in proportion.
+//  3. nil replicas podSets share what is left after 1 and 2 evenly, see distributeEvenly.
+func resolvePodSetReplicas(app *workloadv1beta1.AppSet) []*workloadv1beta1.PodSetReplicas {
+	var total int64
+	if app.Spec.Replicas != nil && *app.Spec.Replicas > 0 {
+		total = int64(*app.Spec.Replicas)
+	}
+
+	var (
+		result     = []*workloadv1beta1.PodSetReplicas{}
+		fixed      int64
+		percentIdx []int
+		nilIdx     []int
+		percents   []int64
+		percentSum int64
+	)
+	for _, cluster := range app.Spec.ClusterTopology.Clusters {
+		if cluster == nil {
+			continue
+		}
+		for _, podSet := range cluster.PodSets {
+			if podSet == nil {
+				continue
+			}
+			r := &workloadv1beta1.PodSetReplicas{
+				ClusterName: cluster.Name,
+				Name:        podSet.Name,
+			}
+			result = append(result, r)
+
+			if podSet.Replicas == nil {
+				nilIdx = append(nilIdx, len(result)-1)
+				continue
+			}
+			if podSet.Replicas.Type == intstr.Int {
+				if podSet.Replicas.IntVal > 0 {
+					r.Replicas = podSet.Replicas.IntVal
+					fixed += int64(r.Replicas)
+				}
+				continue
+			}
+			percent := parsePercent(podSet.Replicas.StrVal)
+			percentIdx = append(percentIdx, len(result)-1)
+			percents = append(percents, percent)
+			percentSum += percent
+		}
+	}
+
+	available := total - fixed
+	if available < 0 {
+		available = 0
+	}
+	available -= resolvePercentReplicas(result, percentIdx, percents, percentSum, total, available)
+	distributeEvenly(result, nilIdx, available)
+	return result
+}
+
+// resolvePercentReplicas set the replicas of percentage podSets, returns the sum of them
+func resolvePercentReplicas(result []*workloadv1beta1.PodSetReplicas, percentIdx []int, percents []int64, percentSum, total, available int64) int64 {
+	if len(percentIdx) == 0 || percentSum == 0 {
+		return 0
+	}
+
+	// quota of each percentage podSet is nums[i] / den
+	nums := make([]int64, len(percents))
+	den := int64(100)
+	target := (total*percentSum + 50) / 100
+	if target > available {
+		target = available
+		den = percentSum
+		for i, p := range percents {
+			nums[i] = target * p
+		}
+	} else {
+		for i, p := range percents {
+			nums[i] = total * p
+		}
+	}
+
+	for i, replicas := range largestRemainder(nums, den, target) {
+		result[percentIdx[i]].Replicas = replicas
+	}
+	return target
+}
+
+// distributeEvenly distribute left replicas to the nil replicas podSets, every one gets
+// left / len(nilIdx), the others are given one by one across clusters first: the n-th extra
+// pod of each cluster goes to the cluster podSets ranked n by name hash, clusters are ranked
+// by name hash too. The ranks only depend on names rather than positions in spec, so reordering
+// changes nothing, and adding or removing a podSet only shifts the podSets ranked behind it.
+func distributeEvenly(result []*workloadv1beta1.PodSetReplicas, nilIdx []int, left int64) {
+	if len(nilIdx) == 0 || left <= 0 {
+		return
+	}
+
+	base := left / int64(len(nilIdx))
+	extra := left % int64(len(nilIdx))
+	for _, idx := range nilIdx {
+		result[idx].Replicas = int32(base)
+	}
+	if extra == 0 {
+		return
+	}
+
+	// rank podSets in each cluster
+	order := make([]int, len(nilIdx))
+	copy(order, nilIdx)
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := result[order[i]], result[order[j]]
+		if a.ClusterName != b.ClusterName {
+			return a.ClusterName < b.ClusterName
+		}
+		return lessByHash(a.Name, b.Name)
+	})
+	rank := make(map[int]int, len(order))
+	for i, idx := range order {
+		if i > 0 && result[order[i-1]].ClusterName == result[idx].ClusterName {
+			rank[idx] = rank[order[i-1]] + 1
+			continue
+		}
+		rank[idx] = 0
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if rank[a] != rank[b] {
+			return rank[a] < rank[b]
+		}
+		return lessByHash(result[a].ClusterName, result[b].ClusterName)
+	})
+	for i := int64(0); i < extra; i++ {
+		result[order[i]].Replicas++
+	}
+}
+
+// lessByHash compare with fnv hash, the order looks random but stable
+func lessByHash(a, b string) bool {
+	ha, hb := fnvHash(a), fnvHash(b)
+	if ha != hb {
+		return ha < hb
+	}
+	return a < b
+}
+
+func fnvHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// largestRemainder distribute target with quota nums[i] / den, every one gets the floor of its
+// quota, the left is given one by one to the larger remainder, the former wins on a tie.
+// The sum of quota must round to target.
+func largestRemainder(nums []int64, den int64, target int64) []int32 {
+	result := make([]int32, len(nums))
+	order := make([]int, len(nums))
+	var sum int64
+	for i, num := range nums {
+		result[i] = int32(num / den)
+		sum += num / den
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return nums[order[i]]%den > nums[order[j]]%den
+	})
+	for i := 0; int64(i) < target-sum && i < len(order); i++ {
+		result[order[i]]++
+	}
+	return result
+}
+
+// parsePercent parse percentage like '10%', the webhook make sure it is valid
+func parsePercent(s string) int64 {
+	i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if err != nil || i < 0 {
+		return 0
+	}
+	return int64(i)
+}
+
+// podSetReplicasOfCluster returns the resolved replicas of podSets in the cluster
+func podSetReplicasOfCluster(resolved []*workloadv1beta1.PodSetReplicas, clusterName string) map[string]int32 {
+	m := map[string]int32{}
+	for _, r := range resolved {
+		if r.ClusterName == clusterName {
+			m[r.Name] = r.Replicas
+		}
+	}
+	return m
+}
@@ -0,0 +1,231 @@
+package appset
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newReplicasAppSet(replicas int32, clusters map[string][]string, order []string) *workloadv1beta1.AppSet {
+	app := &workloadv1beta1.AppSet{}
+	app.Spec.Replicas = &replicas
+	for _, name := range order {
+		cluster := &workloadv1beta1.TargetCluster{Name: name}
+		for i, r := range clusters[name] {
+			podSet := &workloadv1beta1.PodSet{Name: name + "-" + string(rune('a'+i))}
+			if r != "" {
+				v := intstr.Parse(r)
+				podSet.Replicas = &v
+			}
+			cluster.PodSets = append(cluster.PodSets, podSet)
+		}
+		app.Spec.ClusterTopology.Clusters = append(app.Spec.ClusterTopology.Clusters, cluster)
+	}
+	return app
+}
+
+func replicasList(resolved []*workloadv1beta1.PodSetReplicas) []int32 {
+	list := make([]int32, 0, len(resolved))
+	for _, r := range resolved {
+		list = append(list, r.Replicas)
+	}
+	return list
+}
+
+func TestResolvePercentPodSetReplicas(t *testing.T) {
+	args := []struct {
+		name     string
+		replicas int32
+		clusters map[string][]string
+		order    []string
+		expect   []int32
+	}{
+		{
+			name:     "fixed replicas",
+			replicas: 5,
+			clusters: map[string][]string{"c1": {"2", "3"}},
+			order:    []string{"c1"},
+			expect:   []int32{2, 3},
+		},
+		{
+			name:     "percentage divisible",
+			replicas: 10,
+			clusters: map[string][]string{"c1": {"50%"}, "c2": {"30%", "20%"}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{5, 3, 2},
+		},
+		{
+			name:     "percentage total is exact",
+			replicas: 10,
+			clusters: map[string][]string{"c1": {"33%", "33%"}, "c2": {"34%"}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{3, 3, 4},
+		},
+		{
+			name:     "percentage tie goes to the former",
+			replicas: 1,
+			clusters: map[string][]string{"c1": {"50%"}, "c2": {"50%"}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{1, 0},
+		},
+		{
+			name:     "percentage tie with cluster order",
+			replicas: 1,
+			clusters: map[string][]string{"c1": {"50%"}, "c2": {"50%"}},
+			order:    []string{"c2", "c1"},
+			expect:   []int32{1, 0},
+		},
+		{
+			name:     "fixed and percentage",
+			replicas: 10,
+			clusters: map[string][]string{"c1": {"2", "40%"}, "c2": {"40%"}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{2, 4, 4},
+		},
+		{
+			name:     "percentage exceed left replicas",
+			replicas: 10,
+			clusters: map[string][]string{"c1": {"5", "50%"}, "c2": {"50%"}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{5, 3, 2},
+		},
+		{
+			name:     "replicas is zero",
+			replicas: 0,
+			clusters: map[string][]string{"c1": {"50%"}, "c2": {"50%"}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{0, 0},
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			app := newReplicasAppSet(arg.replicas, arg.clusters, arg.order)
+			got := replicasList(resolvePodSetReplicas(app))
+			if !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestBuildAdvdeploymentWithPercentReplicas(t *testing.T) {
+	app := newReplicasAppSet(10, map[string][]string{"c1": {"33%", "33%"}, "c2": {"34%"}}, []string{"c1", "c2"})
+
+	adv, err := buildAdvdeploymentWithApp(app, app.Spec.ClusterTopology.Clusters[0])
+	if err != nil {
+		t.Fatalf("build advdeployment failed: %v", err)
+	}
+	if *adv.Spec.Replicas != 6 {
+		t.Errorf("expect replicas 6, but got %d", *adv.Spec.Replicas)
+	}
+	for _, podSet := range adv.Spec.Topology.PodSets {
+		if podSet.Replicas.Type != intstr.Int || podSet.Replicas.IntVal != 3 {
+			t.Errorf("podSet %s expect replicas 3, but got %s", podSet.Name, podSet.Replicas.String())
+		}
+	}
+	if app.Spec.ClusterTopology.Clusters[0].PodSets[0].Replicas.Type != intstr.String {
+		t.Error("AppSet podSet replicas should not be modified")
+	}
+}
+
+func TestBuildAdvdeploymentWithPriorityStrategy(t *testing.T) {
+	app := newReplicasAppSet(2, map[string][]string{"c1": {"2"}}, []string{"c1"})
+	app.Spec.UpdateStrategy.PriorityStrategy = &workloadv1beta1.UpdatePriorityStrategy{
+		OrderPriority: []workloadv1beta1.UpdatePriorityOrderTerm{{OrderedKey: "sym-order"}},
+	}
+
+	adv, err := buildAdvdeploymentWithApp(app, app.Spec.ClusterTopology.Clusters[0])
+	if err != nil {
+		t.Fatalf("build advdeployment failed: %v", err)
+	}
+	if !reflect.DeepEqual(adv.Spec.UpdateStrategy.PriorityStrategy, app.Spec.UpdateStrategy.PriorityStrategy) {
+		t.Errorf("expect priorityStrategy %v, but got %v", app.Spec.UpdateStrategy.PriorityStrategy, adv.Spec.UpdateStrategy.PriorityStrategy)
+	}
+}
+
+func TestResolveNilPodSetReplicas(t *testing.T) {
+	args := []struct {
+		name     string
+		replicas int32
+		clusters map[string][]string
+		order    []string
+		expect   []int32
+	}{
+		{
+			name:     "nil replicas divisible",
+			replicas: 6,
+			clusters: map[string][]string{"c1": {"", ""}, "c2": {""}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{2, 2, 2},
+		},
+		{
+			name:     "nil replicas share the left",
+			replicas: 10,
+			clusters: map[string][]string{"c1": {"2", ""}, "c2": {"20%", ""}},
+			order:    []string{"c1", "c2"},
+			expect:   []int32{2, 3, 2, 3},
+		},
+		{
+			name:     "no replicas left",
+			replicas: 4,
+			clusters: map[string][]string{"c1": {"4", ""}},
+			order:    []string{"c1"},
+			expect:   []int32{4, 0},
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			app := newReplicasAppSet(arg.replicas, arg.clusters, arg.order)
+			got := replicasList(resolvePodSetReplicas(app))
+			if !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestResolveNilPodSetReplicasBalanced(t *testing.T) {
+	app := newReplicasAppSet(7, map[string][]string{"c1": {"", "", ""}, "c2": {"", "", ""}}, []string{"c1", "c2"})
+	resolved := resolvePodSetReplicas(app)
+
+	var sum int32
+	clusterSum := map[string]int32{}
+	for _, r := range resolved {
+		if r.Replicas < 1 || r.Replicas > 2 {
+			t.Errorf("podSet %s replicas %d is not balanced", r.Name, r.Replicas)
+		}
+		sum += r.Replicas
+		clusterSum[r.ClusterName] += r.Replicas
+	}
+	if sum != 7 {
+		t.Errorf("expect total 7, but got %d", sum)
+	}
+	if d := clusterSum["c1"] - clusterSum["c2"]; d > 1 || d < -1 {
+		t.Errorf("clusters is not balanced: %v", clusterSum)
+	}
+
+	// reorder clusters and podSets, the result should be the same
+	expect := map[string]int32{}
+	for _, r := range resolved {
+		expect[r.Name] = r.Replicas
+	}
+	clusters := app.Spec.ClusterTopology.Clusters
+	clusters[0], clusters[1] = clusters[1], clusters[0]
+	clusters[0].PodSets[0], clusters[0].PodSets[2] = clusters[0].PodSets[2], clusters[0].PodSets[0]
+	for _, r := range resolvePodSetReplicas(app) {
+		if expect[r.Name] != r.Replicas {
+			t.Errorf("podSet %s replicas changed from %d to %d after reorder", r.Name, expect[r.Name], r.Replicas)
+		}
+	}
+
+	// add a podSet, the others replicas change at most one
+	clusters[1].PodSets = append(clusters[1].PodSets, &workloadv1beta1.PodSet{Name: "c1-d"})
+	*app.Spec.Replicas = 8
+	for _, r := range resolvePodSetReplicas(app) {
+		if v, ok := expect[r.Name]; ok && (r.Replicas-v > 1 || v-r.Replicas > 1) {
+			t.Errorf("podSet %s replicas changed from %d to %d after add podSet", r.Name, v, r.Replicas)
+		}
+	}
+}
@@ -110,8 +110,11 @@ func (m *master) stepApplySpec(ctx context.Context, req ktypes.NamespacedName, a
 		if err != nil {
 			return false, err
 		}
-		obj := buildAdvdeploymentWithApp(app, deployClusterSpec)
-		return m.applyAdvdeployment(cli, req, obj)
+		obj, err := buildAdvdeploymentWithApp(app, deployClusterSpec)
+		if err != nil {
+			return false, fmt.Errorf("Build cluster %s Advdeployment %s failed: %v", deployClusterSpec.Name, req, err)
+		}
+		return m.applyAdvdeploymentWithReferences(cli, req, obj)
 	}
 
 	isChanged, errs := m.concurrentExecStepForAppsetSpecifyCluster(req, app, f)
@@ -126,6 +129,24 @@ func (m *master) stepApplySpec(ctx context.Context, req ktypes.NamespacedName, a
 	return nil
 }
 
+// applyAdvdeploymentWithReferences copy the objects referenced by adv before applying it. The copies
+// made before the AdvDeployment is created are owned by it in the same pass, so they are not orphaned
+// when the AppSet is deleted before the next one.
+func (m *master) applyAdvdeploymentWithReferences(cli api.MingleClient, req ktypes.NamespacedName, adv *workloadv1beta1.AdvDeployment) (bool, error) {
+	owned, err := m.applyReferencedObjects(cli, req, adv)
+	if err != nil {
+		return false, err
+	}
+	isChanged, err := m.applyAdvdeployment(cli, req, adv)
+	if err != nil || owned {
+		return isChanged, err
+	}
+	if _, err = m.applyReferencedObjects(cli, req, adv); err != nil {
+		return isChanged, err
+	}
+	return isChanged, nil
+}
+
 func (m *master) applyAdvdeployment(cli api.MingleClient, req ktypes.NamespacedName, new *workloadv1beta1.AdvDeployment) (isChanged bool, err error) {
 	old := &workloadv1beta1.AdvDeployment{}
 	err = cli.Get(req, old)
@@ -234,6 +255,8 @@ func (m *master) buildAppsetStatus(req ktypes.NamespacedName, app *workloadv1bet
 			WarnEvents: []*workloadv1beta1.Event{},
 		},
 	}
+	as.AggrStatus.PodSetReplicas = resolvePodSetReplicas(app)
+	as.AggrStatus.PodSetValues = resolvePodSetValues(app)
 	nsAdvs := m.getAllClusterComplexAdvdeployment(req, app)
 	var (
 		changeObserved = true
@@ -20,6 +20,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/klog/v2"
 	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -280,10 +281,11 @@ func (m *master) getUnexpectAdvdeploymentClusterListSync(req ktypes.NamespacedNa
 	return unexpectClusterList
 }
 
-func buildAdvdeploymentWithApp(app *workloadv1beta1.AppSet, deployClusterSpec *workloadv1beta1.TargetCluster) *workloadv1beta1.AdvDeployment {
+func buildAdvdeploymentWithApp(app *workloadv1beta1.AppSet, deployClusterSpec *workloadv1beta1.TargetCluster) (*workloadv1beta1.AdvDeployment, error) {
+	resolved := podSetReplicasOfCluster(resolvePodSetReplicas(app), deployClusterSpec.Name)
 	var replica int32
 	for _, v := range deployClusterSpec.PodSets {
-		replica += int32(v.Replicas.IntValue())
+		replica += resolved[v.Name]
 	}
 
 	adv := &workloadv1beta1.AdvDeployment{
@@ -299,15 +301,23 @@ func buildAdvdeploymentWithApp(app *workloadv1beta1.AppSet, deployClusterSpec *w
 	}
 	adv.Spec.Replicas = &replica
 	app.Spec.PodSpec.DeepCopyInto(&adv.Spec.PodSpec)
+	if app.Spec.UpdateStrategy.PriorityStrategy != nil {
+		adv.Spec.UpdateStrategy.PriorityStrategy = app.Spec.UpdateStrategy.PriorityStrategy.DeepCopy()
+	}
 
 	for _, set := range deployClusterSpec.PodSets {
 		podSet := set.DeepCopy()
-		if len(podSet.RawValues) == 0 {
-			// mock rawvalues, just for test
+		// the worker only knows integer replicas
+		replicas := intstr.FromInt(int(resolved[podSet.Name]))
+		podSet.Replicas = &replicas
+		values, err := mergePodSetValues(app, deployClusterSpec, set)
+		if err != nil {
+			return nil, err
 		}
+		podSet.RawValues = values
 		adv.Spec.Topology.PodSets = append(adv.Spec.Topology.PodSets, podSet)
 	}
-	return adv
+	return adv, nil
 }
 
 func makeAdvdeploymentLabel(deployClusterSpec *workloadv1beta1.TargetCluster) map[string]string {
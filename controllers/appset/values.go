@@ -0,0 +1,76 @@
+package appset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/helm"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+// mergePodSetValues deep merge the values layers in order: AppSet rawValues, cluster rawValues
+// and podSet rawValues, the latter takes precedence. null is kept to remove the key of the lower
+// layers and chart defaults. The podSet rawValues is returned as it is when the other layers are
+// empty.
+func mergePodSetValues(app *workloadv1beta1.AppSet, cluster *workloadv1beta1.TargetCluster, podSet *workloadv1beta1.PodSet) (string, error) {
+	if app.Spec.RawValues == "" && cluster.RawValues == "" {
+		return podSet.RawValues, nil
+	}
+
+	merged := map[string]interface{}{}
+	layers := []struct {
+		name   string
+		values string
+	}{
+		{name: "AppSet", values: app.Spec.RawValues},
+		{name: "cluster " + cluster.Name, values: cluster.RawValues},
+		{name: "podSet " + podSet.Name, values: podSet.RawValues},
+	}
+	for _, layer := range layers {
+		vals, err := chartutil.ReadValues([]byte(layer.values))
+		if err != nil {
+			return "", fmt.Errorf("read %s rawValues failed: %v", layer.name, err)
+		}
+		merged = helm.MergeValues(merged, vals.AsMap())
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("marshal podSet %s values failed: %v", podSet.Name, err)
+	}
+	return string(out), nil
+}
+
+// resolvePodSetValues returns the merged values hash of all podSets across all target clusters,
+// the result is ordered as spec.clusterTopology.
+func resolvePodSetValues(app *workloadv1beta1.AppSet) []*workloadv1beta1.PodSetValues {
+	result := []*workloadv1beta1.PodSetValues{}
+	for _, cluster := range app.Spec.ClusterTopology.Clusters {
+		if cluster == nil {
+			continue
+		}
+		for _, podSet := range cluster.PodSets {
+			if podSet == nil {
+				continue
+			}
+			v := &workloadv1beta1.PodSetValues{
+				ClusterName: cluster.Name,
+				Name:        podSet.Name,
+			}
+			if values, err := mergePodSetValues(app, cluster, podSet); err == nil {
+				v.Hash = valuesHash(values)
+			}
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// valuesHash returns the short sha256 of values
+func valuesHash(values string) string {
+	sum := sha256.Sum256([]byte(values))
+	return hex.EncodeToString(sum[:])[:16]
+}
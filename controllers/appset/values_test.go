@@ -0,0 +1,154 @@
+package appset
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+func newValuesAppSet() *workloadv1beta1.AppSet {
+	app := &workloadv1beta1.AppSet{}
+	app.Spec.RawValues = "image: app\nport: 80\nresources:\n  cpu: 1\n  memory: 1Gi\n"
+	app.Spec.ClusterTopology.Clusters = []*workloadv1beta1.TargetCluster{
+		{
+			Name:      "gz01",
+			RawValues: "port: 8080\nresources:\n  cpu: 2\n",
+			PodSets: []*workloadv1beta1.PodSet{
+				{Name: "blue", RawValues: "resources:\n  memory: 2Gi\ncolor: blue\n"},
+				{Name: "green"},
+			},
+		},
+		{
+			Name:    "rz01",
+			PodSets: []*workloadv1beta1.PodSet{{Name: "blue", RawValues: "image: app-rz\n"}},
+		},
+	}
+	return app
+}
+
+func TestMergePodSetValues(t *testing.T) {
+	app := newValuesAppSet()
+	gz01, rz01 := app.Spec.ClusterTopology.Clusters[0], app.Spec.ClusterTopology.Clusters[1]
+
+	args := []struct {
+		name    string
+		cluster *workloadv1beta1.TargetCluster
+		podSet  *workloadv1beta1.PodSet
+		expect  map[string]interface{}
+	}{
+		{
+			name:    "all layers",
+			cluster: gz01,
+			podSet:  gz01.PodSets[0],
+			expect: map[string]interface{}{
+				"image":     "app",
+				"port":      float64(8080),
+				"color":     "blue",
+				"resources": map[string]interface{}{"cpu": float64(2), "memory": "2Gi"},
+			},
+		},
+		{
+			name:    "empty podSet values",
+			cluster: gz01,
+			podSet:  gz01.PodSets[1],
+			expect: map[string]interface{}{
+				"image":     "app",
+				"port":      float64(8080),
+				"resources": map[string]interface{}{"cpu": float64(2), "memory": "1Gi"},
+			},
+		},
+		{
+			name:    "empty cluster values",
+			cluster: rz01,
+			podSet:  rz01.PodSets[0],
+			expect: map[string]interface{}{
+				"image":     "app-rz",
+				"port":      float64(80),
+				"resources": map[string]interface{}{"cpu": float64(1), "memory": "1Gi"},
+			},
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			values, err := mergePodSetValues(app, arg.cluster, arg.podSet)
+			if err != nil {
+				t.Fatalf("merge values failed: %v", err)
+			}
+			got := map[string]interface{}{}
+			if err = yaml.Unmarshal([]byte(values), &got); err != nil {
+				t.Fatalf("unmarshal values failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+
+	// null in podSet values removes the key of AppSet values
+	podSet := &workloadv1beta1.PodSet{Name: "red", RawValues: "port: null\nresources:\n  memory: null\n"}
+	values, err := mergePodSetValues(app, gz01, podSet)
+	if err != nil {
+		t.Fatalf("merge values failed: %v", err)
+	}
+	got := map[string]interface{}{}
+	if err = yaml.Unmarshal([]byte(values), &got); err != nil {
+		t.Fatalf("unmarshal values failed: %v", err)
+	}
+	expect := map[string]interface{}{
+		"image":     "app",
+		"port":      nil,
+		"resources": map[string]interface{}{"cpu": float64(2), "memory": nil},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect null kept to remove the key, %v, but got %v", expect, got)
+	}
+
+	// only podSet values
+	app.Spec.RawValues = ""
+	if values, _ := mergePodSetValues(app, rz01, rz01.PodSets[0]); values != rz01.PodSets[0].RawValues {
+		t.Errorf("expect podSet rawValues kept as it is, but got %q", values)
+	}
+
+	gz01.RawValues = "port: [8080"
+	if _, err := mergePodSetValues(app, gz01, gz01.PodSets[0]); err == nil {
+		t.Error("invalid cluster rawValues should return error")
+	}
+}
+
+func TestResolvePodSetValues(t *testing.T) {
+	app := newValuesAppSet()
+	resolved := resolvePodSetValues(app)
+	if len(resolved) != 3 {
+		t.Fatalf("expect 3 podSets, but got %d", len(resolved))
+	}
+	for _, v := range resolved {
+		if len(v.Hash) != 16 {
+			t.Errorf("cluster %s podSet %s expect hash, but got %q", v.ClusterName, v.Name, v.Hash)
+		}
+	}
+	if resolved[0].Hash == resolved[1].Hash {
+		t.Error("different values should have different hash")
+	}
+
+	// the hash changes when any layer changes
+	app.Spec.RawValues = "image: app2\n"
+	changed := resolvePodSetValues(app)
+	for i := range resolved {
+		if changed[i].Hash == resolved[i].Hash {
+			t.Errorf("cluster %s podSet %s hash should change with AppSet values", changed[i].ClusterName, changed[i].Name)
+		}
+	}
+
+	// invalid values have no hash
+	app.Spec.ClusterTopology.Clusters[1].PodSets[0].RawValues = "image: [app"
+	if v := resolvePodSetValues(app)[2]; v.Hash != "" {
+		t.Errorf("expect empty hash of invalid values, but got %s", v.Hash)
+	}
+
+	adv, err := buildAdvdeploymentWithApp(app, app.Spec.ClusterTopology.Clusters[1])
+	if err == nil || adv != nil {
+		t.Error("build advdeployment with invalid values should return error")
+	}
+}
@@ -0,0 +1,106 @@
+package helm
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+)
+
+// NewCapabilities build Capabilities with the cluster discovery, the same as helm install does.
+// The groups failed to discover are skipped, such as an unavailable aggregated apiserver.
+func NewCapabilities(dc discovery.DiscoveryInterface) (*chartutil.Capabilities, error) {
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("get kubernetes server version failed: %v", err)
+	}
+
+	groups, resources, err := dc.ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, fmt.Errorf("get kubernetes api versions failed: %v", err)
+	}
+	if err != nil {
+		klog.Warningf("Discover part of kubernetes api groups failed, skip them: %v", err)
+	}
+
+	apiVersions := chartutil.DefaultVersionSet
+	if len(groups) > 0 || len(resources) > 0 {
+		seen := map[string]struct{}{}
+		apiVersions = chartutil.VersionSet{}
+		add := func(v string) {
+			if _, ok := seen[v]; !ok {
+				seen[v] = struct{}{}
+				apiVersions = append(apiVersions, v)
+			}
+		}
+		for _, g := range groups {
+			for _, gv := range g.Versions {
+				add(gv.GroupVersion)
+			}
+		}
+		// a kind is able to be checked with .Capabilities.APIVersions.Has "apps/v1/Deployment"
+		for _, r := range resources {
+			for _, res := range r.APIResources {
+				add(path.Join(r.GroupVersion, res.Kind))
+			}
+		}
+	}
+
+	return &chartutil.Capabilities{
+		APIVersions: apiVersions,
+		KubeVersion: chartutil.KubeVersion{
+			Version: kubeVersion.GitVersion,
+			Major:   kubeVersion.Major,
+			Minor:   kubeVersion.Minor,
+		},
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}, nil
+}
+
+// CapabilitiesCache caches the Capabilities of a cluster connection, it is discovered again
+// after ttl, so CRDs installed later are visible to charts.
+type CapabilitiesCache struct {
+	dc  discovery.DiscoveryInterface
+	ttl time.Duration
+	now func() time.Time
+
+	lock   sync.Mutex
+	caps   *chartutil.Capabilities
+	expire time.Time
+}
+
+// NewCapabilitiesCache build CapabilitiesCache
+func NewCapabilitiesCache(dc discovery.DiscoveryInterface, ttl time.Duration) *CapabilitiesCache {
+	return &CapabilitiesCache{
+		dc:  dc,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// Get returns the cached Capabilities, the stale one is returned if discover failed
+func (c *CapabilitiesCache) Get() (*chartutil.Capabilities, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
+	if c.caps != nil && now.Before(c.expire) {
+		return c.caps, nil
+	}
+
+	caps, err := NewCapabilities(c.dc)
+	if err != nil {
+		if c.caps != nil {
+			klog.Warningf("Discover capabilities failed, use the stale one: %v", err)
+			return c.caps, nil
+		}
+		return nil, err
+	}
+	c.caps = caps
+	c.expire = now.Add(c.ttl)
+	return caps, nil
+}
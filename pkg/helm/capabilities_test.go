@@ -0,0 +1,144 @@
+package helm
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+func newTestDiscovery() *fakediscovery.FakeDiscovery {
+	dc := fake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	dc.FakedServerVersion = &version.Info{Major: "1", Minor: "18", GitVersion: "v1.18.20"}
+	dc.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment"}},
+		},
+		{
+			GroupVersion: "networking.k8s.io/v1beta1",
+			APIResources: []metav1.APIResource{{Name: "ingresses", Kind: "Ingress"}},
+		},
+	}
+	return dc
+}
+
+// failedDiscovery fails to get server version if failed is set
+type failedDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	failed bool
+}
+
+func (d *failedDiscovery) ServerVersion() (*version.Info, error) {
+	if d.failed {
+		return nil, errors.New("connection refused")
+	}
+	return d.FakeDiscovery.ServerVersion()
+}
+
+func TestNewCapabilities(t *testing.T) {
+	caps, err := NewCapabilities(newTestDiscovery())
+	if err != nil {
+		t.Fatalf("new capabilities failed: %v", err)
+	}
+	if caps.KubeVersion.Version != "v1.18.20" || caps.KubeVersion.Major != "1" || caps.KubeVersion.Minor != "18" {
+		t.Errorf("expect kube version v1.18.20, but got %v", caps.KubeVersion)
+	}
+	for _, v := range []string{"apps/v1", "apps/v1/Deployment", "networking.k8s.io/v1beta1/Ingress"} {
+		if !caps.APIVersions.Has(v) {
+			t.Errorf("expect api version %s, but got %v", v, caps.APIVersions)
+		}
+	}
+	if caps.APIVersions.Has("networking.k8s.io/v1") {
+		t.Errorf("unexpected api version networking.k8s.io/v1")
+	}
+}
+
+func TestCapabilitiesCache(t *testing.T) {
+	dc := newTestDiscovery()
+	var calls int
+	dc.PrependReactor("get", "version", func(action kubetesting.Action) (bool, runtime.Object, error) {
+		calls++
+		return false, nil, nil
+	})
+
+	fd := &failedDiscovery{FakeDiscovery: dc}
+	cache := NewCapabilitiesCache(fd, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(); err != nil {
+			t.Fatalf("get capabilities failed: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("capabilities should be cached in ttl, but discovered %d times", calls)
+	}
+
+	// expired and discover failed, use the stale one
+	now = now.Add(time.Minute * 2)
+	fd.failed = true
+	caps, err := cache.Get()
+	if err != nil || caps.KubeVersion.Version != "v1.18.20" {
+		t.Errorf("expect the stale capabilities, but got %v, %v", caps, err)
+	}
+}
+
+func TestRenderTemplateWithCapabilities(t *testing.T) {
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion:  chart.APIVersionV2,
+			Name:        "ingress",
+			Version:     "1.0.0",
+			KubeVersion: ">=1.16.0-0",
+		},
+		Templates: []*chart.File{
+			{
+				Name: "templates/ingress.yaml",
+				Data: []byte(`{{- if .Capabilities.APIVersions.Has "networking.k8s.io/v1/Ingress" }}
+apiVersion: networking.k8s.io/v1
+{{- else }}
+apiVersion: networking.k8s.io/v1beta1
+{{- end }}
+kind: Ingress
+metadata:
+  name: {{ .Release.Name }}
+  annotations:
+    kube-version: {{ .Capabilities.KubeVersion.Version }}
+`),
+			},
+		},
+	}
+	file, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatalf("save chart failed: %v", err)
+	}
+	pkg, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read chart failed: %v", err)
+	}
+
+	caps, _ := NewCapabilities(newTestDiscovery())
+	objs, err := RenderTemplate(pkg, "app", "default", "", caps, nil)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if len(objs) != 1 || objs[0].GroupVersionKind().Version != "v1beta1" || objs[0].UnstructuredObject().GetAnnotations()["kube-version"] != "v1.18.20" {
+		t.Errorf("expect networking.k8s.io/v1beta1 Ingress rendered with v1.18.20, but got %v", objs)
+	}
+
+	caps.KubeVersion = chartutil.KubeVersion{Version: "v1.15.0", Major: "1", Minor: "15"}
+	if _, err = RenderTemplate(pkg, "app", "default", "", caps, nil); err == nil {
+		t.Error("expect error when kubeVersion is incompatible")
+	}
+}
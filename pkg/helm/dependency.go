@@ -0,0 +1,54 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// processDependencies removes the dependencies disabled by condition or tags and imports the
+// values of subcharts, the same as helm install does. Dependencies are never downloaded when
+// rendering, so the enabled ones must be vendored in the archive.
+func processDependencies(chrt *chart.Chart, vals chartutil.Values) error {
+	if err := chartutil.ProcessDependencies(chrt, vals); err != nil {
+		return fmt.Errorf("process chart %s dependencies failed: %v", chrt.Name(), err)
+	}
+	return checkDependencies(chrt)
+}
+
+// checkDependencies returns error if any enabled dependency in Chart.yaml has no subchart with
+// compatible version, the disabled ones are removed by processDependencies already.
+func checkDependencies(chrt *chart.Chart) error {
+	subcharts := map[string]string{}
+	for _, sub := range chrt.Dependencies() {
+		subcharts[sub.Name()] = sub.Metadata.Version
+	}
+
+	var missing, incompatible []string
+	for _, dep := range chrt.Metadata.Dependencies {
+		version, ok := subcharts[dep.Name]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%s (version %q, repository %q)", dep.Name, dep.Version, dep.Repository))
+			continue
+		}
+		// the version is a semver range, empty means any version
+		if dep.Version != "" && !chartutil.IsCompatibleRange(dep.Version, version) {
+			incompatible = append(incompatible, fmt.Sprintf("%s (version %q, vendored %q)", dep.Name, dep.Version, version))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("chart %s dependencies are enabled but missing in charts/ directory, run helm dependency update before packaging: %s", chrt.Name(), strings.Join(missing, ", "))
+	}
+	if len(incompatible) > 0 {
+		return fmt.Errorf("chart %s dependencies in charts/ directory are incompatible with Chart.yaml, run helm dependency update before packaging: %s", chrt.Name(), strings.Join(incompatible, ", "))
+	}
+
+	for _, sub := range chrt.Dependencies() {
+		if err := checkDependencies(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package helm
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+func newDependencyChart(name string, values map[string]interface{}) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: "0.1.0"},
+		Values:   values,
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}-{{ .Chart.Name }}\n"),
+			},
+		},
+	}
+}
+
+// newDependencyChartPackage build chart app with dependencies: redis enabled by condition,
+// mysql enabled by tags and common whose values are imported. The dependencies not vendored
+// are listed in Chart.yaml only, vendored name:version overrides the subchart version.
+func newDependencyChartPackage(t *testing.T, vendored ...string) []byte {
+	chrt := newDependencyChart("app", map[string]interface{}{
+		"redis": map[string]interface{}{"enabled": false},
+	})
+	chrt.Templates = append(chrt.Templates, &chart.File{
+		Name: "templates/imported.yaml",
+		Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}-imported\ndata:\n  color: {{ .Values.commonConfig.color | quote }}\n"),
+	})
+	chrt.Metadata.Dependencies = []*chart.Dependency{
+		{Name: "redis", Version: "0.1.0", Repository: "https://charts.example.com", Condition: "redis.enabled"},
+		{Name: "mysql", Version: "~0.1.0", Repository: "https://charts.example.com", Tags: []string{"database"}},
+		{Name: "common", Version: "0.1.0", Repository: "https://charts.example.com", ImportValues: []interface{}{
+			map[string]interface{}{"child": "config", "parent": "commonConfig"},
+		}},
+	}
+
+	subcharts := map[string]*chart.Chart{
+		"redis":  newDependencyChart("redis", nil),
+		"mysql":  newDependencyChart("mysql", nil),
+		"common": newDependencyChart("common", map[string]interface{}{"config": map[string]interface{}{"color": "blue"}}),
+	}
+	for _, name := range vendored {
+		version := ""
+		if i := strings.Index(name, ":"); i >= 0 {
+			name, version = name[:i], name[i+1:]
+		}
+		sub := subcharts[name]
+		if version != "" {
+			sub.Metadata.Version = version
+		}
+		chrt.AddDependency(sub)
+	}
+	return saveTestChart(t, chrt)
+}
+
+// saveTestChart package chrt with its values and dependencies
+func saveTestChart(t *testing.T, chrt *chart.Chart) []byte {
+	// values.yaml is saved from the raw file
+	for _, c := range append([]*chart.Chart{chrt}, chrt.Dependencies()...) {
+		if c.Values == nil {
+			continue
+		}
+		raw, err := yaml.Marshal(c.Values)
+		if err != nil {
+			t.Fatalf("marshal chart %s values failed: %v", c.Name(), err)
+		}
+		c.Raw = append(c.Raw, &chart.File{Name: chartutil.ValuesfileName, Data: raw})
+	}
+
+	file, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatalf("save chart failed: %v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read chart failed: %v", err)
+	}
+	return data
+}
+
+func TestRenderTemplateWithDependencies(t *testing.T) {
+	args := []struct {
+		name        string
+		vendored    []string
+		values      string
+		expectNames []string
+		expectErr   string
+	}{
+		{
+			name:        "default",
+			vendored:    []string{"redis", "mysql", "common"},
+			expectNames: []string{"app-app", "app-common", "app-imported", "app-mysql"},
+		},
+		{
+			name:        "condition and tags",
+			vendored:    []string{"redis", "mysql", "common"},
+			values:      "redis:\n  enabled: true\ntags:\n  database: false\n",
+			expectNames: []string{"app-app", "app-common", "app-imported", "app-redis"},
+		},
+		{
+			name:        "disabled dependency missing",
+			vendored:    []string{"mysql", "common"},
+			expectNames: []string{"app-app", "app-common", "app-imported", "app-mysql"},
+		},
+		{
+			name:      "enabled dependency missing",
+			vendored:  []string{"common"},
+			expectErr: `missing in charts/ directory, run helm dependency update before packaging: mysql (version "~0.1.0", repository "https://charts.example.com")`,
+		},
+		{
+			name:        "compatible dependency version",
+			vendored:    []string{"redis", "mysql:0.1.3", "common"},
+			expectNames: []string{"app-app", "app-common", "app-imported", "app-mysql"},
+		},
+		{
+			name:      "incompatible dependency version",
+			vendored:  []string{"redis", "mysql:0.2.0", "common"},
+			expectErr: `incompatible with Chart.yaml, run helm dependency update before packaging: mysql (version "~0.1.0", vendored "0.2.0")`,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			objs, err := RenderTemplate(newDependencyChartPackage(t, arg.vendored...), "app", "default", arg.values, nil, nil)
+			if arg.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), arg.expectErr) {
+					t.Errorf("expect error %s, but got %v", arg.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+
+			names := []string{}
+			for _, obj := range objs {
+				names = append(names, obj.GetName())
+				if obj.GetName() == "app-imported" {
+					data := obj.UnstructuredObject().Object["data"].(map[string]interface{})
+					if data["color"] != "blue" {
+						t.Errorf("expect imported color blue, but got %v", data["color"])
+					}
+				}
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, arg.expectNames) {
+				t.Errorf("expect %v, but got %v", arg.expectNames, names)
+			}
+		})
+	}
+}
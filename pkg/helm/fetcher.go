@@ -0,0 +1,554 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	chartFileSuffix = ".tgz"
+	indexFileName   = "index.yaml"
+	indexCacheDir   = "index"
+	chartCacheDir   = "charts"
+	// digestRecordSuffix is the suffix of files recording the digest of mutable chart urls
+	digestRecordSuffix = ".digest"
+)
+
+// FetcherOptions chart fetcher options
+type FetcherOptions struct {
+	// CacheDir is the directory charts and repository index files are cached in
+	CacheDir string
+	// IndexTTL is how long the repository index file, chart package urls and OCI tags are reused
+	// before downloading again
+	IndexTTL time.Duration
+	// ChartTTL the cached chart is removed if it is not used for ChartTTL
+	ChartTTL time.Duration
+	// MaxCacheSize is the max bytes of cached charts, the least recently used ones are
+	// removed when exceeded, 0 means no limit
+	MaxCacheSize int64
+	// Timeout of each http request
+	Timeout time.Duration
+}
+
+// DefaultFetcherOptions returns default chart fetcher options
+func DefaultFetcherOptions() *FetcherOptions {
+	return &FetcherOptions{
+		CacheDir:     filepath.Join(os.TempDir(), "sym-ops", "charts"),
+		IndexTTL:     time.Minute * 5,
+		ChartTTL:     time.Hour * 24 * 7,
+		MaxCacheSize: 1 << 30,
+		Timeout:      time.Second * 30,
+	}
+}
+
+// ChartFetcher fetch chart package from chart repository or OCI registry, charts are cached
+// on disk with name, version and digest.
+type ChartFetcher struct {
+	*FetcherOptions
+
+	client *http.Client
+	now    func() time.Time
+
+	// lock protects keyLocks and serializes evicting, network I/O is never done with it held
+	lock     sync.Mutex
+	keyLocks map[string]*keyLock
+
+	registryLock    sync.Mutex
+	registryClients map[string]*registry.Client
+}
+
+// keyLock serializes fetching the same cache key, so it is downloaded once
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewChartFetcher build ChartFetcher
+func NewChartFetcher(opt *FetcherOptions) (*ChartFetcher, error) {
+	if opt == nil {
+		opt = DefaultFetcherOptions()
+	}
+	for _, dir := range []string{indexCacheDir, chartCacheDir, registryConfigDir} {
+		if err := os.MkdirAll(filepath.Join(opt.CacheDir, dir), 0755); err != nil {
+			return nil, fmt.Errorf("create chart cache dir failed: %v", err)
+		}
+	}
+	return &ChartFetcher{
+		FetcherOptions:  opt,
+		client:          &http.Client{Timeout: opt.Timeout},
+		now:             time.Now,
+		keyLocks:        map[string]*keyLock{},
+		registryClients: map[string]*registry.Client{},
+	}, nil
+}
+
+// repoIndex is the part of chart repository index.yaml used by fetcher
+type repoIndex struct {
+	Entries map[string][]*repoChartVersion `json:"entries"`
+}
+
+type repoChartVersion struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	URLs    []string `json:"urls"`
+	Digest  string   `json:"digest,omitempty"`
+}
+
+// Credentials username and password of chart repository or OCI registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Fetch returns the chart package of chartURL without credentials, see FetchWithCredentials
+func (f *ChartFetcher) Fetch(chartURL, version string) ([]byte, error) {
+	return f.FetchWithCredentials(chartURL, version, nil)
+}
+
+// FetchWithCredentials returns the chart package of chartURL. chartURL is one of:
+//  1. chart package url, exp: https://charts.example.com/nginx-1.0.0.tgz, version is ignored
+//  2. chart repository url with chart name, exp: https://charts.example.com/nginx, the chart
+//     version is resolved with the repository index.yaml, version is a semver version or
+//     constraint, empty means the latest stable version.
+//  3. OCI reference, exp: oci://registry.example.com/charts/nginx, version is the tag, it
+//     could also be given as oci://registry.example.com/charts/nginx:1.0.0
+//
+// cred is optional, it is sent with basic auth or used to login the OCI registry.
+func (f *ChartFetcher) FetchWithCredentials(chartURL, version string, cred *Credentials) ([]byte, error) {
+	u, err := url.Parse(chartURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse chart url %s failed: %v", chartURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != ociScheme {
+		return nil, fmt.Errorf("chart url %s scheme %s is not supported", chartURL, u.Scheme)
+	}
+
+	if u.Scheme == ociScheme {
+		return f.fetchOCI(u, version, cred)
+	}
+	if strings.HasSuffix(u.Path, chartFileSuffix) {
+		// the package url may be overwritten, reuse it in IndexTTL like the repository index
+		name := strings.TrimSuffix(path.Base(u.Path), chartFileSuffix)
+		return f.fetchPackage(chartURL, name, cred, chartURL+"\n"+credentialsKey(u.Host, cred), f.IndexTTL)
+	}
+
+	name := path.Base(u.Path)
+	u.Path = path.Dir(u.Path)
+	repoURL := u.String()
+
+	cv, err := f.resolveChartVersion(repoURL, name, version, cred)
+	if err != nil {
+		return nil, err
+	}
+	if len(cv.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s-%s in repository %s has no url", name, cv.Version, repoURL)
+	}
+	pkgURL, err := resolveReferenceURL(repoURL, cv.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	// the package may be hosted by others, such as a CDN, never leak the repository credentials
+	pkgCred := credentialsForURL(repoURL, pkgURL, cred)
+
+	// charts are reused only by whom has downloaded them with the same credentials
+	key := pkgURL + "\n" + credentialsKey(u.Host, cred)
+	if cv.Digest == "" {
+		// chart versions are immutable, the package without digest is recorded by url and never
+		// expires
+		return f.fetchPackage(pkgURL, cv.Name+"-"+cv.Version, pkgCred, key, 0)
+	}
+
+	unlock := f.lockKey(key)
+	defer unlock()
+
+	cachePath := f.chartCachePath(cv.Name, cv.Version, cv.Digest)
+	if digest, _ := f.recordedDigest(key, 0); strings.EqualFold(digest, cv.Digest) {
+		if data, ok := f.readCache(cachePath); ok {
+			klog.V(5).Infof("Chart %s-%s hit cache %s", cv.Name, cv.Version, cachePath)
+			return data, nil
+		}
+	}
+	data, err := f.download(pkgURL, pkgCred)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256Hex(data)
+	if !strings.EqualFold(cv.Digest, digest) {
+		return nil, fmt.Errorf("chart %s digest %s is not equal to the repository index digest %s", pkgURL, digest, cv.Digest)
+	}
+	f.writeCache(cachePath, data)
+	f.recordDigest(key, digest)
+	return data, nil
+}
+
+// fetchPackage download chart package by url, the digest downloaded is recorded with key and
+// reused in ttl, 0 means it never expires. The recorded one is also used when download failed.
+func (f *ChartFetcher) fetchPackage(pkgURL, name string, cred *Credentials, key string, ttl time.Duration) ([]byte, error) {
+	unlock := f.lockKey(key)
+	defer unlock()
+
+	digest, fresh := f.recordedDigest(key, ttl)
+	if fresh {
+		if data, ok := f.readCache(f.chartCachePath(name, "", digest)); ok {
+			klog.V(5).Infof("Chart %s hit cache", pkgURL)
+			return data, nil
+		}
+	}
+
+	data, err := f.download(pkgURL, cred)
+	if err != nil {
+		if digest == "" {
+			return nil, err
+		}
+		cachePath := f.chartCachePath(name, "", digest)
+		if data, ok := f.readCache(cachePath); ok {
+			klog.Warningf("Download chart %s failed, use cache %s: %v", pkgURL, cachePath, err)
+			return data, nil
+		}
+		return nil, err
+	}
+	digest = sha256Hex(data)
+	f.writeCache(f.chartCachePath(name, "", digest), data)
+	f.recordDigest(key, digest)
+	return data, nil
+}
+
+// resolveChartVersion find the chart version in repository index file
+func (f *ChartFetcher) resolveChartVersion(repoURL, name, version string, cred *Credentials) (*repoChartVersion, error) {
+	index, err := f.loadIndex(repoURL, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	var constraint *semver.Constraints
+	if version != "" {
+		constraint, err = semver.NewConstraint(version)
+		if err != nil {
+			return nil, fmt.Errorf("chart version %s is invalid: %v", version, err)
+		}
+	}
+
+	var (
+		found      *repoChartVersion
+		foundVer   *semver.Version
+		candidates = index.Entries[name]
+	)
+	for _, cv := range candidates {
+		if cv.Version == version {
+			// exact match, such as non-semver version
+			return cv, nil
+		}
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil {
+			continue
+		}
+		if constraint == nil {
+			if v.Prerelease() != "" {
+				continue
+			}
+		} else if !constraint.Check(v) {
+			continue
+		}
+		if foundVer == nil || v.GreaterThan(foundVer) {
+			found, foundVer = cv, v
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("chart %s version %q not found in repository %s", name, version, repoURL)
+	}
+	return found, nil
+}
+
+// loadIndex load repository index file, the cached one is used in IndexTTL or when download failed.
+// The index is cached per credentials, so private repositories are never listed to others.
+func (f *ChartFetcher) loadIndex(repoURL string, cred *Credentials) (*repoIndex, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse repository url %s failed: %v", repoURL, err)
+	}
+	key := repoURL + "\n" + credentialsKey(u.Host, cred)
+	cachePath := filepath.Join(f.CacheDir, indexCacheDir, sha256Hex([]byte(key))+".yaml")
+	unlock := f.lockKey(cachePath)
+	defer unlock()
+
+	var data []byte
+	info, err := os.Stat(cachePath)
+	if err == nil && f.now().Sub(info.ModTime()) < f.IndexTTL {
+		data, err = ioutil.ReadFile(cachePath)
+	}
+	if len(data) == 0 || err != nil {
+		indexURL, rerr := resolveReferenceURL(repoURL, indexFileName)
+		if rerr != nil {
+			return nil, rerr
+		}
+		data, err = f.download(indexURL, cred)
+		if err != nil {
+			cached, rerr := ioutil.ReadFile(cachePath)
+			if rerr != nil {
+				return nil, err
+			}
+			klog.Warningf("Download repository %s index failed, use cache: %v", repoURL, err)
+			data = cached
+		} else if werr := writeFileAtomic(cachePath, data); werr != nil {
+			klog.Errorf("Cache repository %s index failed: %v", repoURL, werr)
+		}
+	}
+
+	index := &repoIndex{}
+	if err = yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("parse repository %s index failed: %v", repoURL, err)
+	}
+	return index, nil
+}
+
+// credentialsForURL returns cred only if u is on the same scheme and host as repoURL, the same
+// as helm with pass-credentials disabled
+func credentialsForURL(repoURL, u string, cred *Credentials) *Credentials {
+	if cred == nil {
+		return nil
+	}
+	repo, err := url.Parse(repoURL)
+	if err != nil {
+		return nil
+	}
+	target, err := url.Parse(u)
+	if err != nil {
+		return nil
+	}
+	if repo.Scheme != target.Scheme || repo.Host != target.Host {
+		return nil
+	}
+	return cred
+}
+
+// credentialsKey returns the key of cred used in host, charts recorded with it are never
+// reused by others
+func credentialsKey(host string, cred *Credentials) string {
+	if cred == nil {
+		return "anonymous"
+	}
+	return sha256Hex([]byte(host + "\n" + cred.Username + "\n" + cred.Password))
+}
+
+func (f *ChartFetcher) download(u string, cred *Credentials) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download %s failed: %v", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s failed: %s", u, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %v", u, err)
+	}
+	return data, nil
+}
+
+// chartCachePath returns <name>-<version>-<digest>.tgz
+func (f *ChartFetcher) chartCachePath(name, version, digest string) string {
+	fileName := name
+	if version != "" {
+		fileName += "-" + version
+	}
+	return filepath.Join(f.CacheDir, chartCacheDir, fileName+"-"+strings.ToLower(digest)+chartFileSuffix)
+}
+
+// readCache read cached chart, the modify time is updated as access time for LRU
+func (f *ChartFetcher) readCache(cachePath string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return nil, false
+	}
+	// the digest is the suffix of file name, check whether the file is broken
+	digest := strings.TrimSuffix(cachePath, chartFileSuffix)
+	digest = digest[strings.LastIndex(digest, "-")+1:]
+	if sha256Hex(data) != digest {
+		klog.Warningf("Chart cache %s is broken, remove it", cachePath)
+		os.Remove(cachePath)
+		return nil, false
+	}
+
+	now := f.now()
+	os.Chtimes(cachePath, now, now)
+	return data, true
+}
+
+// recordedDigest returns the chart digest recorded with key, and whether it is recorded in ttl,
+// 0 means it never expires.
+func (f *ChartFetcher) recordedDigest(key string, ttl time.Duration) (string, bool) {
+	recordPath := f.digestRecordPath(key)
+	info, err := os.Stat(recordPath)
+	if err != nil {
+		return "", false
+	}
+	digest, err := ioutil.ReadFile(recordPath)
+	if err != nil || len(digest) == 0 {
+		return "", false
+	}
+	return string(digest), ttl <= 0 || f.now().Sub(info.ModTime()) < ttl
+}
+
+func (f *ChartFetcher) recordDigest(key, digest string) {
+	recordPath := f.digestRecordPath(key)
+	if err := writeFileAtomic(recordPath, []byte(digest)); err != nil {
+		klog.Errorf("Record chart digest %s failed: %v", recordPath, err)
+		return
+	}
+	now := f.now()
+	os.Chtimes(recordPath, now, now)
+}
+
+func (f *ChartFetcher) digestRecordPath(key string) string {
+	return filepath.Join(f.CacheDir, indexCacheDir, sha256Hex([]byte(key))+digestRecordSuffix)
+}
+
+func (f *ChartFetcher) writeCache(cachePath string, data []byte) {
+	if err := writeFileAtomic(cachePath, data); err != nil {
+		klog.Errorf("Cache chart %s failed: %v", cachePath, err)
+		return
+	}
+	now := f.now()
+	os.Chtimes(cachePath, now, now)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.evict()
+}
+
+// lockKey lock key and returns the unlock func, the lock of key is removed once no one uses it
+func (f *ChartFetcher) lockKey(key string) func() {
+	f.lock.Lock()
+	l, ok := f.keyLocks[key]
+	if !ok {
+		l = &keyLock{}
+		f.keyLocks[key] = l
+	}
+	l.refs++
+	f.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		f.lock.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(f.keyLocks, key)
+		}
+		f.lock.Unlock()
+	}
+}
+
+// evict remove charts not used in ChartTTL, then remove the least recently used ones until
+// the total size is not more than MaxCacheSize.
+func (f *ChartFetcher) evict() {
+	dir := filepath.Join(f.CacheDir, chartCacheDir)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		klog.Errorf("Read chart cache dir %s failed: %v", dir, err)
+		return
+	}
+
+	now := f.now()
+	var (
+		total int64
+		alive []os.FileInfo
+	)
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), chartFileSuffix) {
+			continue
+		}
+		if f.ChartTTL > 0 && now.Sub(info.ModTime()) > f.ChartTTL {
+			f.removeCache(filepath.Join(dir, info.Name()))
+			continue
+		}
+		total += info.Size()
+		alive = append(alive, info)
+	}
+	if f.MaxCacheSize <= 0 || total <= f.MaxCacheSize {
+		return
+	}
+
+	sort.Slice(alive, func(i, j int) bool {
+		return alive[i].ModTime().Before(alive[j].ModTime())
+	})
+	// keep the latest one at least
+	for i := 0; i < len(alive)-1 && total > f.MaxCacheSize; i++ {
+		f.removeCache(filepath.Join(dir, alive[i].Name()))
+		total -= alive[i].Size()
+	}
+}
+
+func (f *ChartFetcher) removeCache(file string) {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		klog.Errorf("Remove chart cache %s failed: %v", file, err)
+		return
+	}
+	klog.V(4).Infof("Remove chart cache %s", file)
+}
+
+// writeFileAtomic write to a temp file and rename, so others never read a half written file
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// resolveReferenceURL resolve refURL relative to baseURL, baseURL is treated as a directory
+func resolveReferenceURL(baseURL, refURL string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("parse repository url %s failed: %v", baseURL, err)
+	}
+	ref, err := url.Parse(refURL)
+	if err != nil {
+		return "", fmt.Errorf("parse chart url %s failed: %v", refURL, err)
+	}
+	if ref.Scheme == "" && ref.Host == "" && ref.Path == "" {
+		return "", errors.New("chart url is empty")
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,423 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func newTestChartPackage(t *testing.T, name, version string) []byte {
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       name,
+			Version:    version,
+		},
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n"),
+			},
+		},
+	}
+	return saveTestChart(t, chrt)
+}
+
+// testChartRepo is a chart repository stand-in
+type testChartRepo struct {
+	*httptest.Server
+	packages map[string][]byte
+	requests map[string]*int32
+}
+
+func newTestChartRepo(t *testing.T, name string, versions ...string) *testChartRepo {
+	repo := &testChartRepo{
+		packages: map[string][]byte{},
+		requests: map[string]*int32{},
+	}
+
+	index := "apiVersion: v1\nentries:\n  " + name + ":\n"
+	for _, version := range versions {
+		file := fmt.Sprintf("%s-%s.tgz", name, version)
+		data := newTestChartPackage(t, name, version)
+		repo.packages["/charts/"+file] = data
+		index += fmt.Sprintf("  - name: %s\n    version: %s\n    digest: %s\n    urls:\n    - charts/%s\n", name, version, sha256Hex(data), file)
+	}
+	repo.packages["/index.yaml"] = []byte(index)
+	for p := range repo.packages {
+		repo.requests[p] = new(int32)
+	}
+
+	repo.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := repo.packages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(repo.requests[r.URL.Path], 1)
+		w.Write(data)
+	}))
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+func (r *testChartRepo) requestCount(p string) int32 {
+	return atomic.LoadInt32(r.requests[p])
+}
+
+func newTestChartFetcher(t *testing.T) *ChartFetcher {
+	opt := DefaultFetcherOptions()
+	opt.CacheDir = t.TempDir()
+	f, err := NewChartFetcher(opt)
+	if err != nil {
+		t.Fatalf("new chart fetcher failed: %v", err)
+	}
+	return f
+}
+
+func TestChartFetcherFetch(t *testing.T) {
+	repo := newTestChartRepo(t, "nginx", "1.0.0", "1.1.0", "1.2.0-rc.1", "2.0.0")
+	f := newTestChartFetcher(t)
+
+	args := []struct {
+		name    string
+		url     string
+		version string
+		want    string
+		wantErr bool
+	}{
+		{name: "exact version", url: repo.URL + "/nginx", version: "1.1.0", want: "1.1.0"},
+		{name: "latest stable version", url: repo.URL + "/nginx", version: "", want: "2.0.0"},
+		{name: "version constraint", url: repo.URL + "/nginx", version: "~1.0", want: "1.0.0"},
+		{name: "chart package url", url: repo.URL + "/charts/nginx-1.1.0.tgz", want: "1.1.0"},
+		{name: "version not found", url: repo.URL + "/nginx", version: "3.0.0", wantErr: true},
+		{name: "chart not found", url: repo.URL + "/redis", version: "", wantErr: true},
+		{name: "unsupported scheme", url: "ftp://example.com/nginx", wantErr: true},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			data, err := f.Fetch(arg.url, arg.version)
+			if (err != nil) != arg.wantErr {
+				t.Fatalf("expect error %v, but got %v", arg.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			chrt, err := loader.LoadArchive(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatalf("load chart failed: %v", err)
+			}
+			if chrt.Metadata.Version != arg.want {
+				t.Errorf("expect version %s, but got %s", arg.want, chrt.Metadata.Version)
+			}
+		})
+	}
+}
+
+func TestChartFetcherCache(t *testing.T) {
+	repo := newTestChartRepo(t, "nginx", "1.0.0")
+	f := newTestChartFetcher(t)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.Fetch(repo.URL+"/nginx", "1.0.0"); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	}
+	if c := repo.requestCount("/index.yaml"); c != 1 {
+		t.Errorf("index should be cached in ttl, but requested %d times", c)
+	}
+	if c := repo.requestCount("/charts/nginx-1.0.0.tgz"); c != 1 {
+		t.Errorf("chart should be cached, but requested %d times", c)
+	}
+	cached, _ := filepath.Glob(filepath.Join(f.CacheDir, chartCacheDir, "nginx-1.0.0-*.tgz"))
+	if len(cached) != 1 {
+		t.Errorf("expect one cached chart named with name version and digest, but got %v", cached)
+	}
+
+	// index expired
+	now = now.Add(f.IndexTTL + time.Second)
+	if _, err := f.Fetch(repo.URL+"/nginx", "1.0.0"); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if c := repo.requestCount("/index.yaml"); c != 2 {
+		t.Errorf("index should be downloaded again after ttl, but requested %d times", c)
+	}
+
+	// repository is down, use cache
+	repo.Close()
+	now = now.Add(f.IndexTTL + time.Second)
+	if _, err := f.Fetch(repo.URL+"/nginx", "1.0.0"); err != nil {
+		t.Errorf("cached index and chart should be used when repository is down: %v", err)
+	}
+}
+
+func TestChartFetcherEvict(t *testing.T) {
+	repo := newTestChartRepo(t, "nginx", "1.0.0", "1.1.0", "1.2.0")
+	f := newTestChartFetcher(t)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	if _, err := f.Fetch(repo.URL+"/nginx", "1.0.0"); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	size := int64(len(repo.packages["/charts/nginx-1.0.0.tgz"]))
+
+	// keep two charts at most
+	f.MaxCacheSize = size*2 + size/2
+	for _, version := range []string{"1.1.0", "1.2.0"} {
+		now = now.Add(time.Minute)
+		setAllCacheModTime(t, f, now.Add(-time.Second))
+		if _, err := f.Fetch(repo.URL+"/nginx", version); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	}
+	cached, _ := filepath.Glob(filepath.Join(f.CacheDir, chartCacheDir, "*.tgz"))
+	if len(cached) != 2 {
+		t.Errorf("expect two cached charts, but got %v", cached)
+	}
+	if matched, _ := filepath.Glob(filepath.Join(f.CacheDir, chartCacheDir, "nginx-1.0.0-*.tgz")); len(matched) != 0 {
+		t.Errorf("the least recently used chart should be removed")
+	}
+
+	// all expired except the new one
+	now = now.Add(f.ChartTTL + time.Minute)
+	setAllCacheModTime(t, f, now.Add(-f.ChartTTL-time.Second))
+	if _, err := f.Fetch(repo.URL+"/charts/nginx-1.0.0.tgz", ""); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	cached, _ = filepath.Glob(filepath.Join(f.CacheDir, chartCacheDir, "*.tgz"))
+	if len(cached) != 1 {
+		t.Errorf("expired charts should be removed, but got %v", cached)
+	}
+}
+
+func setAllCacheModTime(t *testing.T, f *ChartFetcher, mtime time.Time) {
+	files, _ := filepath.Glob(filepath.Join(f.CacheDir, chartCacheDir, "*.tgz"))
+	for _, file := range files {
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatalf("change mod time failed: %v", err)
+		}
+	}
+}
+
+func TestCredentialsForURL(t *testing.T) {
+	cred := &Credentials{Username: "user", Password: "pass"}
+	args := []struct {
+		name   string
+		url    string
+		expect *Credentials
+	}{
+		{name: "same host", url: "https://charts.example.com/charts/nginx-1.0.0.tgz", expect: cred},
+		{name: "other host", url: "https://cdn.example.com/nginx-1.0.0.tgz", expect: nil},
+		{name: "other port", url: "https://charts.example.com:8443/nginx-1.0.0.tgz", expect: nil},
+		{name: "other scheme", url: "http://charts.example.com/nginx-1.0.0.tgz", expect: nil},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			if got := credentialsForURL("https://charts.example.com", arg.url, cred); got != arg.expect {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
+
+func TestChartFetcherCredentialsNotLeaked(t *testing.T) {
+	data := newTestChartPackage(t, "nginx", "1.0.0")
+	var leaked int32
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok {
+			atomic.AddInt32(&leaked, 1)
+		}
+		w.Write(data)
+	}))
+	defer cdn.Close()
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "apiVersion: v1\nentries:\n  nginx:\n  - name: nginx\n    version: 1.0.0\n    urls:\n    - %s/nginx-1.0.0.tgz\n", cdn.URL)
+	}))
+	defer repo.Close()
+
+	f := newTestChartFetcher(t)
+	if _, err := f.FetchWithCredentials(repo.URL+"/nginx", "1.0.0", &Credentials{Username: "user", Password: "pass"}); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if leaked != 0 {
+		t.Errorf("credentials should not be sent to other hosts")
+	}
+}
+
+func TestChartFetcherPrivateRepository(t *testing.T) {
+	args := []struct {
+		name        string
+		publicIndex bool
+	}{
+		{name: "private repository"},
+		{name: "public index and private packages", publicIndex: true},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			data := newTestChartPackage(t, "nginx", "1.0.0")
+			repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/index.yaml" && arg.publicIndex {
+					fmt.Fprintf(w, "apiVersion: v1\nentries:\n  nginx:\n  - name: nginx\n    version: 1.0.0\n    digest: %s\n    urls:\n    - nginx-1.0.0.tgz\n", sha256Hex(data))
+					return
+				}
+				if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if r.URL.Path == "/index.yaml" {
+					fmt.Fprintf(w, "apiVersion: v1\nentries:\n  nginx:\n  - name: nginx\n    version: 1.0.0\n    digest: %s\n    urls:\n    - nginx-1.0.0.tgz\n", sha256Hex(data))
+					return
+				}
+				w.Write(data)
+			}))
+			defer repo.Close()
+
+			f := newTestChartFetcher(t)
+			if _, err := f.FetchWithCredentials(repo.URL+"/nginx", "1.0.0", &Credentials{Username: "user", Password: "pass"}); err != nil {
+				t.Fatalf("fetch with credentials failed: %v", err)
+			}
+			// the index and chart cached are not reused without the same credentials in IndexTTL
+			if _, err := f.Fetch(repo.URL+"/nginx", "1.0.0"); err == nil {
+				t.Errorf("expect fetch without credentials failed, but got nil")
+			}
+			if _, err := f.FetchWithCredentials(repo.URL+"/nginx", "1.0.0", &Credentials{Username: "user", Password: "wrong"}); err == nil {
+				t.Errorf("expect fetch with wrong credentials failed, but got nil")
+			}
+		})
+	}
+}
+
+func TestChartFetcherPackageCache(t *testing.T) {
+	repo := newTestChartRepo(t, "nginx", "1.0.0")
+	f := newTestChartFetcher(t)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	pkgURL := repo.URL + "/charts/nginx-1.0.0.tgz"
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.Fetch(pkgURL, ""); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	}
+	if c := repo.requestCount("/charts/nginx-1.0.0.tgz"); c != 1 {
+		t.Errorf("chart package should be cached in ttl, but requested %d times", c)
+	}
+
+	// the package is overwritten, it is downloaded after ttl
+	repo.packages["/charts/nginx-1.0.0.tgz"] = append(newTestChartPackage(t, "nginx", "1.0.0"), 0)
+	now = now.Add(f.IndexTTL + time.Second)
+	data, err := f.Fetch(pkgURL, "")
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if c := repo.requestCount("/charts/nginx-1.0.0.tgz"); c != 2 || sha256Hex(data) != sha256Hex(repo.packages["/charts/nginx-1.0.0.tgz"]) {
+		t.Errorf("chart package should be downloaded again after ttl, requested %d times", c)
+	}
+
+	// the package downloaded with credentials is not reused by others
+	if _, err := f.FetchWithCredentials(pkgURL, "", &Credentials{Username: "user", Password: "pass"}); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if c := repo.requestCount("/charts/nginx-1.0.0.tgz"); c != 3 {
+		t.Errorf("chart package should be downloaded with credentials, requested %d times", c)
+	}
+
+	// repository is down, use cache
+	repo.Close()
+	now = now.Add(f.IndexTTL + time.Second)
+	if _, err := f.Fetch(pkgURL, ""); err != nil {
+		t.Errorf("cached chart should be used when repository is down: %v", err)
+	}
+}
+
+func TestChartFetcherCacheWithoutDigest(t *testing.T) {
+	data := newTestChartPackage(t, "nginx", "1.0.0")
+	var requests int32
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.yaml" {
+			fmt.Fprint(w, "apiVersion: v1\nentries:\n  nginx:\n  - name: nginx\n    version: 1.0.0\n    urls:\n    - nginx-1.0.0.tgz\n")
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		w.Write(data)
+	}))
+	defer repo.Close()
+
+	f := newTestChartFetcher(t)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		if _, err := f.Fetch(repo.URL+"/nginx", "1.0.0"); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+		now = now.Add(f.IndexTTL + time.Second)
+	}
+	if c := atomic.LoadInt32(&requests); c != 1 {
+		t.Errorf("chart version without digest should be cached, but requested %d times", c)
+	}
+}
+
+func TestChartFetcherLockPerKey(t *testing.T) {
+	data := newTestChartPackage(t, "nginx", "1.0.0")
+	var requests int32
+	block := make(chan struct{})
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow/nginx-1.0.0.tgz" {
+			atomic.AddInt32(&requests, 1)
+			<-block
+		}
+		w.Write(data)
+	}))
+	defer repo.Close()
+	f := newTestChartFetcher(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Fetch(repo.URL+"/slow/nginx-1.0.0.tgz", ""); err != nil {
+				t.Errorf("fetch failed: %v", err)
+			}
+		}()
+	}
+
+	// others are not blocked by the slow download
+	done := make(chan error)
+	go func() {
+		_, err := f.Fetch(repo.URL+"/fast/nginx-1.0.0.tgz", "")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("fetch failed: %v", err)
+		}
+	case <-time.After(time.Second * 10):
+		t.Errorf("fetch should not be blocked by the download of others")
+	}
+
+	close(block)
+	wg.Wait()
+	if c := atomic.LoadInt32(&requests); c != 1 {
+		t.Errorf("the same chart should be downloaded once, but requested %d times", c)
+	}
+}
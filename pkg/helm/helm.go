@@ -3,32 +3,60 @@ package helm
 import (
 	"bytes"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/engine"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 )
 
-// RenderTemplate render chart template to k8s object slice
-func RenderTemplate(chartPkg []byte, rlsName, ns string, overrideValue string) ([]K8sObject, error) {
-	renderedTpls, err := renderTpls(chartPkg, rlsName, ns, overrideValue)
+const notesFileSuffix = "NOTES.txt"
+
+// SymValuesKey is the values namespace injected by sym-ops, charts use it as .Values.sym.*.
+// The chart schema never knows it, so it is not validated.
+const SymValuesKey = "sym"
+
+// RenderTemplate render chart template to k8s object slice, caps is the target cluster
+// Capabilities, nil means the helm default Capabilities. The chart lookup function reads
+// the cluster with lookup config, see NewLookupConfig, nil means lookup always returns empty.
+func RenderTemplate(chartPkg []byte, rlsName, ns string, overrideValue string, caps *chartutil.Capabilities, lookup *rest.Config) ([]K8sObject, error) {
+	renderedTpls, err := renderTpls(chartPkg, rlsName, ns, overrideValue, caps, lookup)
 	if err != nil {
 		return nil, err
 	}
-	return buildK8sObjectWithRenderedTpls(renderedTpls), nil
+	return buildK8sObjectWithRenderedTpls(renderedTpls)
 }
 
-func renderTpls(chartPkg []byte, rlsName, ns string, overrideValue string) (renderedTpls map[string]string, err error) {
+func renderTpls(chartPkg []byte, rlsName, ns string, overrideValue string, caps *chartutil.Capabilities, lookup *rest.Config) (renderedTpls map[string]string, err error) {
 	chrt, err := loader.LoadArchive(bytes.NewBuffer(chartPkg))
 	if err != nil {
 		return nil, fmt.Errorf("loading chart has an error: %v", err)
 	}
+	if caps != nil && chrt.Metadata.KubeVersion != "" && !chartutil.IsCompatibleRange(chrt.Metadata.KubeVersion, caps.KubeVersion.String()) {
+		return nil, fmt.Errorf("chart requires kubeVersion: %s which is incompatible with Kubernetes %s", chrt.Metadata.KubeVersion, caps.KubeVersion.String())
+	}
 	chrtVals, err := chartutil.ReadValues([]byte(overrideValue))
 	if err != nil {
 		return nil, fmt.Errorf("read overridevalue %s has an error: %v", overrideValue, err)
 	}
+	if err = processDependencies(chrt, chrtVals); err != nil {
+		return nil, err
+	}
+	// the sym values are set after validation, see SymValuesKey
+	sym, hasSym := chrtVals[SymValuesKey]
+	delete(chrtVals, SymValuesKey)
+	// validate here rather than in ToRenderValues, so every violation is reported with its path
+	coalesced, err := chartutil.CoalesceValues(chrt, chrtVals)
+	if err != nil {
+		return nil, fmt.Errorf("coalesce chart values has an error: %v", err)
+	}
+	if err = ValidateValuesSchema(chrt, coalesced); err != nil {
+		return nil, err
+	}
 	opts := chartutil.ReleaseOptions{
 		Name:      rlsName,
 		Namespace: ns,
@@ -36,34 +64,49 @@ func renderTpls(chartPkg []byte, rlsName, ns string, overrideValue string) (rend
 		IsInstall: true,
 		IsUpgrade: false,
 	}
-	chrtValues, err := chartutil.ToRenderValues(chrt, chrtVals, opts, nil)
+	chrtValues, err := chartutil.ToRenderValues(chrt, chrtVals, opts, caps)
 	if err != nil {
 		return nil, fmt.Errorf("render chart values has an error: %v", err)
 	}
-	renderedTpls, err = engine.Render(chrt, chrtValues)
+	if hasSym {
+		chrtValues["Values"].(chartutil.Values)[SymValuesKey] = sym
+	}
+	if lookup != nil {
+		renderedTpls, err = engine.RenderWithClient(chrt, chrtValues, lookup)
+	} else {
+		renderedTpls, err = engine.Render(chrt, chrtValues)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("render error: %v", err)
 	}
 	return renderedTpls, nil
 }
 
-func buildK8sObjectWithRenderedTpls(renderedTpls map[string]string) []K8sObject {
+// buildK8sObjectWithRenderedTpls parse all documents of the rendered templates, NOTES.txt and
+// partials are not manifests, skip them. The objects are returned in install order.
+func buildK8sObjectWithRenderedTpls(renderedTpls map[string]string) ([]K8sObject, error) {
+	names := make([]string, 0, len(renderedTpls))
+	for name := range renderedTpls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var objects []K8sObject
-	for name, tpl := range renderedTpls {
-		yaml := removeNonYAMLLines(tpl)
-		if yaml == "" {
+	for _, name := range names {
+		if strings.HasSuffix(name, notesFileSuffix) || strings.HasPrefix(path.Base(name), "_") {
 			continue
 		}
-		o, err := ParseYAML2K8sObject([]byte(yaml))
+		objs, err := ParseYAML2K8sObjects([]byte(renderedTpls[name]))
 		if err != nil {
-			// !import some text parse error must skip it. such as:templates/NOTES.txt
-			klog.Errorf("Failed to parse %s yaml %s to k8s object: %v", name, yaml, err)
-			continue
+			return nil, fmt.Errorf("failed to parse template %s: %v", name, err)
+		}
+		for _, o := range objs {
+			klog.V(5).Infof("Render k8s object %s %s/%s success", o.GroupKind().Kind, o.GetNamespace(), o.GetName())
 		}
-		objects = append(objects, o)
-		klog.V(5).Infof("Render k8s object %s %s/%s success", o.GroupKind().Kind, o.GetNamespace(), o.GetName())
+		objects = append(objects, objs...)
 	}
-	return objects
+	SortByInstallOrder(objects)
+	return objects, nil
 }
 
 func removeNonYAMLLines(yamlStr string) string {
@@ -95,24 +95,24 @@ func TestRenderTpls(t *testing.T) {
 	}
 
 	// error chartPkg
-	_, err = renderTpls([]byte("error charts"), chartName, "", "")
+	_, err = renderTpls([]byte("error charts"), chartName, "", "", nil, nil)
 	if err == nil {
 		t.Error("error charts must have error")
 		return
 	}
 	// error overrideValue
-	_, err = renderTpls(charts, chartName, "", "error overrideValue")
+	_, err = renderTpls(charts, chartName, "", "error overrideValue", nil, nil)
 	if err == nil {
 		t.Error("error overrideValue must have error")
 		return
 	}
-	_, err = renderTpls(charts, chartName, "", fmt.Sprintf(overrideValue, "a b"))
+	_, err = renderTpls(charts, chartName, "", fmt.Sprintf(overrideValue, "a b"), nil, nil)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	// empty real name
-	_, err = renderTpls(charts, "", "", "")
+	_, err = renderTpls(charts, "", "", "", nil, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -120,7 +120,7 @@ func TestRenderTpls(t *testing.T) {
 
 	// normal
 	resetControllerName := "reset-controller-name"
-	result, err := renderTpls(charts, chartName, "", fmt.Sprintf(overrideValue, resetControllerName))
+	result, err := renderTpls(charts, chartName, "", fmt.Sprintf(overrideValue, resetControllerName), nil, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -137,31 +137,69 @@ func TestRenderTpls(t *testing.T) {
 
 func TestBuildK8sObjectWithRenderedTpls(t *testing.T) {
 	// renderedTpls is nil
-	k8sobjs := buildK8sObjectWithRenderedTpls(nil)
-	if len(k8sobjs) > 0 {
+	k8sobjs, err := buildK8sObjectWithRenderedTpls(nil)
+	if err != nil || len(k8sobjs) > 0 {
 		t.Error("nil renderedTpls must be empty k8sobj")
 		return
 	}
 
 	// renderedTpls content is empty
-	k8sobjs = buildK8sObjectWithRenderedTpls(map[string]string{
+	k8sobjs, err = buildK8sObjectWithRenderedTpls(map[string]string{
 		"1": "",
 		"2": "####",
+		"3": "---\n# comment\n---\n",
 	})
-	if len(k8sobjs) > 0 {
+	if err != nil || len(k8sobjs) > 0 {
 		t.Error("empty yaml must be empty k8sobj")
 		return
 	}
 	// error renderedTpls
-	k8sobjs = buildK8sObjectWithRenderedTpls(map[string]string{
-		"1": "error yaml",
+	_, err = buildK8sObjectWithRenderedTpls(map[string]string{
+		"templates/deployment.yaml": "error yaml",
 	})
-	if len(k8sobjs) > 0 {
-		t.Error("error yaml must be empty k8sobj")
+	if err == nil {
+		t.Error("error yaml must have error")
+		return
+	}
+	// NOTES.txt and partials are skipped
+	k8sobjs, err = buildK8sObjectWithRenderedTpls(map[string]string{
+		"chart/templates/NOTES.txt":    "error yaml",
+		"chart/templates/_helpers.tpl": "error yaml",
+	})
+	if err != nil || len(k8sobjs) > 0 {
+		t.Error("NOTES.txt and partials must be skipped")
+		return
+	}
+	// multi documents
+	k8sobjs, err = buildK8sObjectWithRenderedTpls(map[string]string{
+		"chart/templates/all.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+---
+---
+# Source: chart/templates/all.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deploy
+`,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(k8sobjs) != 2 || k8sobjs[0].GroupKind().Kind != "Service" || k8sobjs[1].GroupKind().Kind != "Deployment" {
+		t.Errorf("multi documents must be parsed in order, but got %d objects", len(k8sobjs))
 		return
 	}
 
-	k8sobjs = buildK8sObjectWithRenderedTpls(renderedTpls)
+	k8sobjs, err = buildK8sObjectWithRenderedTpls(renderedTpls)
+	if err != nil {
+		t.Error(err)
+		return
+	}
 	for _, obj := range k8sobjs {
 		t.Log(obj.YAML2String())
 	}
@@ -169,13 +207,13 @@ func TestBuildK8sObjectWithRenderedTpls(t *testing.T) {
 
 func TestRenderTemplate(t *testing.T) {
 	// error chart
-	_, err := RenderTemplate([]byte("error chart"), "", "", "")
+	_, err := RenderTemplate([]byte("error chart"), "", "", "", nil, nil)
 	if err == nil {
 		t.Error("error char must have error")
 		return
 	}
 
-	k8sobjs, err := RenderTemplate(charts, chartName, "", fmt.Sprintf(overrideValue, "RenderTemplate-controller"))
+	k8sobjs, err := RenderTemplate(charts, chartName, "", fmt.Sprintf(overrideValue, "RenderTemplate-controller"), nil, nil)
 	if err != nil {
 		t.Error(err)
 		return
@@ -0,0 +1,48 @@
+package helm
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+// podTemplateLabelsPath is the path of pod template labels of the workload kinds
+var podTemplateLabelsPath = map[string][]string{
+	"Deployment":            {"spec", "template", "metadata", "labels"},
+	"StatefulSet":           {"spec", "template", "metadata", "labels"},
+	"DaemonSet":             {"spec", "template", "metadata", "labels"},
+	"ReplicaSet":            {"spec", "template", "metadata", "labels"},
+	"ReplicationController": {"spec", "template", "metadata", "labels"},
+	"Job":                   {"spec", "template", "metadata", "labels"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "metadata", "labels"},
+}
+
+// AddTrackingLabels stamps labels on every object, and on the pod template of workloads. The
+// object labels are overwritten, while the existing pod template labels are kept, since they may
+// be matched by the workload selector or Services. Selectors are never changed.
+func AddTrackingLabels(objects []K8sObject, labels map[string]string) {
+	for _, obj := range objects {
+		obj.AddLabels(labels)
+
+		path, ok := podTemplateLabelsPath[obj.GroupKind().Kind]
+		if !ok {
+			continue
+		}
+		u := obj.UnstructuredObject()
+		templateLabels, _, err := unstructured.NestedStringMap(u.Object, path...)
+		if err != nil {
+			klog.Warningf("Get %s %s/%s pod template labels failed: %v", obj.GroupKind().Kind, obj.GetNamespace(), obj.GetName(), err)
+			continue
+		}
+		if templateLabels == nil {
+			templateLabels = map[string]string{}
+		}
+		for k, v := range labels {
+			if _, exist := templateLabels[k]; !exist {
+				templateLabels[k] = v
+			}
+		}
+		if err = unstructured.SetNestedStringMap(u.Object, templateLabels, path...); err != nil {
+			klog.Warningf("Set %s %s/%s pod template labels failed: %v", obj.GroupKind().Kind, obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+}
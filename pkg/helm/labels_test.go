@@ -0,0 +1,99 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const trackingLabelsManifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  labels:
+    app: nginx
+spec:
+  selector:
+    matchLabels:
+      app: nginx
+  template:
+    metadata:
+      labels:
+        app: nginx
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: nginx
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          restartPolicy: Never
+`
+
+func TestAddTrackingLabels(t *testing.T) {
+	objs, err := ParseYAML2K8sObjects([]byte(trackingLabelsManifests))
+	if err != nil {
+		t.Fatalf("parse manifests failed: %v", err)
+	}
+	labels := map[string]string{"app": "demo", "sym-podset": "blue"}
+	AddTrackingLabels(objs, labels)
+
+	args := []struct {
+		name   string
+		obj    K8sObject
+		path   []string
+		expect map[string]string
+	}{
+		{
+			name:   "configmap labels",
+			obj:    objs[0],
+			path:   []string{"metadata", "labels"},
+			expect: labels,
+		},
+		{
+			name:   "deployment labels overwritten",
+			obj:    objs[1],
+			path:   []string{"metadata", "labels"},
+			expect: labels,
+		},
+		{
+			name:   "deployment pod template labels kept",
+			obj:    objs[1],
+			path:   []string{"spec", "template", "metadata", "labels"},
+			expect: map[string]string{"app": "nginx", "sym-podset": "blue"},
+		},
+		{
+			name:   "deployment selector not changed",
+			obj:    objs[1],
+			path:   []string{"spec", "selector", "matchLabels"},
+			expect: map[string]string{"app": "nginx"},
+		},
+		{
+			name:   "cronjob pod template labels",
+			obj:    objs[2],
+			path:   []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels"},
+			expect: labels,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			got, _, err := unstructured.NestedStringMap(arg.obj.UnstructuredObject().Object, arg.path...)
+			if err != nil {
+				t.Fatalf("get labels failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// NewLookupConfig returns a copy of config used by the chart lookup function. The requests are
+// read only, and limited to namespace if it is not empty: the objects in the other namespaces and
+// the cluster scoped objects are reported as not found, the same as what lookup returns when
+// rendering without a cluster.
+func NewLookupConfig(config *rest.Config, namespace string) *rest.Config {
+	if config == nil {
+		return nil
+	}
+	prefix := ""
+	if u, err := url.Parse(config.Host); err == nil {
+		prefix = strings.TrimSuffix(u.Path, "/")
+	}
+
+	cfg := rest.CopyConfig(config)
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &lookupRoundTripper{
+			rt:        rt,
+			prefix:    prefix,
+			namespace: namespace,
+		}
+	})
+	return cfg
+}
+
+// lookupRoundTripper rejects the requests not allowed for lookup
+type lookupRoundTripper struct {
+	rt        http.RoundTripper
+	prefix    string
+	namespace string
+}
+
+func (l *lookupRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return nil, fmt.Errorf("lookup is read only, %s %s is not allowed", req.Method, req.URL.Path)
+	}
+	p := strings.TrimPrefix(req.URL.Path, l.prefix)
+	if !lookupAllowed(p, l.namespace) {
+		klog.V(4).Infof("Lookup %s is out of namespace %s, treat it as not found", p, l.namespace)
+		return notFoundResponse(req, p)
+	}
+	return l.rt.RoundTrip(req)
+}
+
+// lookupAllowed reports whether the api path is able to be read by lookup limited to namespace,
+// the discovery paths are always allowed.
+func lookupAllowed(p, namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	var rest []string
+	switch segments[0] {
+	case "api":
+		// /api/{version}/...
+		if len(segments) <= 2 {
+			return true
+		}
+		rest = segments[2:]
+	case "apis":
+		// /apis/{group}/{version}/...
+		if len(segments) <= 3 {
+			return true
+		}
+		rest = segments[3:]
+	default:
+		return false
+	}
+	return len(rest) >= 2 && rest[0] == "namespaces" && rest[1] == namespace
+}
+
+func notFoundResponse(req *http.Request, p string) (*http.Response, error) {
+	status := apierrors.NewNotFound(schema.GroupResource{}, p).Status()
+	status.Kind = "Status"
+	status.APIVersion = "v1"
+	body, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusNotFound, http.StatusText(http.StatusNotFound)),
+		StatusCode:    http.StatusNotFound,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
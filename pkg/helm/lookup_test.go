@@ -0,0 +1,125 @@
+package helm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// newTestAPIServer serves Secret app-secret in every namespace
+func newTestAPIServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "secrets", Namespaced: true, Kind: "Secret", Verbs: metav1.Verbs{"get", "list"}},
+			},
+		})
+	})
+	mux.HandleFunc("/api/v1/namespaces/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"app-secret"},"data":{"password":"ZXhpc3Rpbmc="}}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newLookupChartPackage(t *testing.T) []byte {
+	tpl := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  current: {{ lookup "v1" "Secret" .Release.Namespace "app-secret" | dig "data" "password" "generated" | quote }}
+  other: {{ lookup "v1" "Secret" "other" "app-secret" | dig "data" "password" "generated" | quote }}
+`
+	chrt := &chart.Chart{
+		Metadata:  &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "lookup", Version: "0.1.0"},
+		Templates: []*chart.File{{Name: "templates/configmap.yaml", Data: []byte(tpl)}},
+	}
+	return saveTestChart(t, chrt)
+}
+
+func TestRenderTemplateWithLookup(t *testing.T) {
+	server := newTestAPIServer(t)
+	pkg := newLookupChartPackage(t)
+	config := &rest.Config{Host: server.URL}
+
+	args := []struct {
+		name          string
+		lookup        *rest.Config
+		expectCurrent string
+		expectOther   string
+	}{
+		{
+			name:          "without client",
+			lookup:        nil,
+			expectCurrent: "generated",
+			expectOther:   "generated",
+		},
+		{
+			name:          "limited to namespace",
+			lookup:        NewLookupConfig(config, "default"),
+			expectCurrent: "ZXhpc3Rpbmc=",
+			expectOther:   "generated",
+		},
+		{
+			name:          "all namespaces",
+			lookup:        NewLookupConfig(config, ""),
+			expectCurrent: "ZXhpc3Rpbmc=",
+			expectOther:   "ZXhpc3Rpbmc=",
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			objs, err := RenderTemplate(pkg, "app", "default", "", nil, arg.lookup)
+			if err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+			if len(objs) != 1 {
+				t.Fatalf("expect 1 object, but got %d", len(objs))
+			}
+			data := objs[0].UnstructuredObject().Object["data"].(map[string]interface{})
+			if data["current"] != arg.expectCurrent || data["other"] != arg.expectOther {
+				t.Errorf("expect current %s other %s, but got %v", arg.expectCurrent, arg.expectOther, data)
+			}
+		})
+	}
+}
+
+func TestLookupAllowed(t *testing.T) {
+	args := []struct {
+		name      string
+		path      string
+		namespace string
+		expect    bool
+	}{
+		{name: "all namespaces", path: "/api/v1/namespaces/other/secrets/a", namespace: "", expect: true},
+		{name: "core discovery", path: "/api/v1", namespace: "default", expect: true},
+		{name: "group discovery", path: "/apis/apps/v1", namespace: "default", expect: true},
+		{name: "core namespaced", path: "/api/v1/namespaces/default/secrets/a", namespace: "default", expect: true},
+		{name: "group namespaced list", path: "/apis/apps/v1/namespaces/default/deployments", namespace: "default", expect: true},
+		{name: "other namespace", path: "/api/v1/namespaces/other/secrets/a", namespace: "default", expect: false},
+		{name: "cross namespaces list", path: "/apis/apps/v1/deployments", namespace: "default", expect: false},
+		{name: "cluster scoped", path: "/apis/storage.k8s.io/v1/storageclasses/standard", namespace: "default", expect: false},
+		{name: "other namespace object", path: "/api/v1/namespaces/other", namespace: "default", expect: false},
+		{name: "not api", path: "/version", namespace: "default", expect: false},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			if got := lookupAllowed(arg.path, arg.namespace); got != arg.expect {
+				t.Errorf("expect %v, but got %v", arg.expect, got)
+			}
+		})
+	}
+}
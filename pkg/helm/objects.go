@@ -1,9 +1,11 @@
 package helm
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/symcn/sym-ops/pkg/utils"
@@ -183,6 +185,32 @@ func ParseYAML2K8sObject(yaml []byte) (K8sObject, error) {
 	return NewK8sObject(out, nil, yaml), nil
 }
 
+// ParseYAML2K8sObjects parsed multi-document YAML to k8sobj slice, empty documents are skipped.
+func ParseYAML2K8sObjects(yaml []byte) ([]K8sObject, error) {
+	var objects []K8sObject
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(yaml)))
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading yaml document %d: %v", i, err)
+		}
+
+		doc = []byte(removeNonYAMLLines(string(doc)))
+		if len(doc) == 0 || string(doc) == "---" || string(doc) == "null" {
+			continue
+		}
+		o, err := ParseYAML2K8sObject(doc)
+		if err != nil {
+			return nil, fmt.Errorf("yaml document %d: %v", i, err)
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
 // ParseJSON2K8sObject parses JSON to an k8sobj.
 func ParseJSON2K8sObject(json []byte) (K8sObject, error) {
 	o, _, err := unstructured.UnstructuredJSONScheme.Decode(json, nil, nil)
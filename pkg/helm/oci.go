@@ -0,0 +1,131 @@
+package helm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ociScheme = "oci"
+
+	// registryConfigDir keeps the docker config files of registry credentials, helm registry
+	// client reads credentials from the config file only
+	registryConfigDir = "registry"
+)
+
+// fetchOCI pull chart with helm registry client. Tags are mutable, the digest pulled is recorded
+// and reused in IndexTTL like the repository index, the recorded one is also used when the
+// registry can not be reached, so charts are never served from cache to whom the registry
+// refuses.
+func (f *ChartFetcher) fetchOCI(u *url.URL, version string, cred *Credentials) ([]byte, error) {
+	repository, tag := parseOCIReference(u, version)
+	if repository == "" || tag == "" {
+		return nil, fmt.Errorf("chart %s version is required", u)
+	}
+	name := path.Base(repository) + "-" + tag
+	ref := u.Host + "/" + repository + ":" + tag
+
+	// the digest is recorded per credentials, so a chart is never reused by whom not authorized
+	credKey := credentialsKey(u.Host, cred)
+	key := ociScheme + "://" + ref + "\n" + credKey
+	unlock := f.lockKey(key)
+	defer unlock()
+
+	digest, fresh := f.recordedDigest(key, f.IndexTTL)
+	if fresh {
+		if data, ok := f.readCache(f.chartCachePath(name, "", digest)); ok {
+			klog.V(5).Infof("Chart %s hit cache", ref)
+			return data, nil
+		}
+	}
+
+	client, err := f.registryClient(u.Host, credKey, cred)
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.Pull(ref, registry.PullOptWithChart(true))
+	if err != nil {
+		unavailable := isUnavailable(err)
+		err = fmt.Errorf("pull chart %s failed: %v", ref, err)
+		if !unavailable || digest == "" {
+			return nil, err
+		}
+		cachePath := f.chartCachePath(name, "", digest)
+		if data, ok := f.readCache(cachePath); ok {
+			klog.Warningf("Use cache %s: %v", cachePath, err)
+			return data, nil
+		}
+		return nil, err
+	}
+
+	data := result.Chart.Data
+	digest = sha256Hex(data)
+	f.writeCache(f.chartCachePath(name, "", digest), data)
+	f.recordDigest(key, digest)
+	return data, nil
+}
+
+// parseOCIReference returns the repository and tag of oci://<host>/<repository>[:<tag>],
+// version takes precedence over the tag in url.
+func parseOCIReference(u *url.URL, version string) (repository, tag string) {
+	repository = strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	if version != "" {
+		tag = version
+	}
+	return repository, tag
+}
+
+// registryClient returns the helm registry client of host with cred, clients are reused so
+// that the registry tokens are reused.
+func (f *ChartFetcher) registryClient(host, credKey string, cred *Credentials) (*registry.Client, error) {
+	configFile := filepath.Join(f.CacheDir, registryConfigDir, credKey+".json")
+
+	f.registryLock.Lock()
+	defer f.registryLock.Unlock()
+
+	if client, ok := f.registryClients[configFile]; ok {
+		return client, nil
+	}
+	if cred != nil {
+		config, err := json.Marshal(map[string]interface{}{
+			"auths": map[string]interface{}{
+				host: map[string]string{
+					"auth": base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Password)),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// the temp file is created with 0600
+		if err = writeFileAtomic(configFile, config); err != nil {
+			return nil, fmt.Errorf("write registry %s credentials failed: %v", host, err)
+		}
+	}
+
+	client, err := registry.NewClient(registry.ClientOptCredentialsFile(configFile))
+	if err != nil {
+		return nil, fmt.Errorf("build registry %s client failed: %v", host, err)
+	}
+	f.registryClients[configFile] = client
+	return client, nil
+}
+
+// isUnavailable returns whether err is caused by the network
+func isUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
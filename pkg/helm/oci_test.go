@@ -0,0 +1,201 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// testRegistry is an OCI registry stand-in with bearer token auth, it is served with plain http
+// on localhost which helm registry client allows.
+type testRegistry struct {
+	*httptest.Server
+	host string
+	// tag -> chart package
+	charts        map[string][]byte
+	manifestCount int32
+	blobCount     int32
+}
+
+func newTestRegistry(t *testing.T, repository, username, password string, versions ...string) *testRegistry {
+	r := &testRegistry{charts: map[string][]byte{}}
+	name := repository[strings.LastIndex(repository, "/")+1:]
+	for _, version := range versions {
+		r.charts[strings.ReplaceAll(version, "+", "_")] = newTestChartPackage(t, name, version)
+	}
+
+	// manifest returns the manifest and config of tag or manifest digest
+	manifest := func(reference string) (data, config []byte, ok bool) {
+		for tag, chrt := range r.charts {
+			config, _ = json.Marshal(map[string]string{"apiVersion": "v2", "name": name, "version": strings.ReplaceAll(tag, "_", "+")})
+			data, _ = json.Marshal(map[string]interface{}{
+				"schemaVersion": 2,
+				"config":        map[string]interface{}{"mediaType": registry.ConfigMediaType, "digest": "sha256:" + sha256Hex(config), "size": len(config)},
+				"layers": []map[string]interface{}{
+					{"mediaType": registry.ChartLayerMediaType, "digest": "sha256:" + sha256Hex(chrt), "size": len(chrt)},
+				},
+			})
+			if reference == tag || reference == "sha256:"+sha256Hex(data) {
+				return data, config, true
+			}
+		}
+		return nil, nil, false
+	}
+
+	const token = "test-token"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if u, p, ok := req.BasicAuth(); !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:"+repository+":pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+	})
+	mux.HandleFunc("/v2/"+repository+"/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`, r.URL, repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p := strings.TrimPrefix(req.URL.Path, "/v2/"+repository+"/")
+		switch {
+		case strings.HasPrefix(p, "manifests/"):
+			data, _, ok := manifest(strings.TrimPrefix(p, "manifests/"))
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			atomic.AddInt32(&r.manifestCount, 1)
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", "sha256:"+sha256Hex(data))
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			if req.Method == http.MethodGet {
+				w.Write(data)
+			}
+		case strings.HasPrefix(p, "blobs/"):
+			for tag, chrt := range r.charts {
+				_, config, _ := manifest(tag)
+				switch p {
+				case "blobs/sha256:" + sha256Hex(config):
+					w.Write(config)
+					return
+				case "blobs/sha256:" + sha256Hex(chrt):
+					atomic.AddInt32(&r.blobCount, 1)
+					w.Write(chrt)
+					return
+				}
+			}
+			http.NotFound(w, req)
+		default:
+			http.NotFound(w, req)
+		}
+	})
+
+	r.Server = httptest.NewServer(mux)
+	u, _ := url.Parse(r.URL)
+	r.host = u.Host
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestChartFetcherFetchOCI(t *testing.T) {
+	r := newTestRegistry(t, "charts/nginx", "user", "pass", "1.0.0", "1.1.0+build.1")
+	f := newTestChartFetcher(t)
+	cred := &Credentials{Username: "user", Password: "pass"}
+
+	args := []struct {
+		name    string
+		url     string
+		version string
+		cred    *Credentials
+		want    string
+		wantErr bool
+	}{
+		{name: "version", url: "oci://" + r.host + "/charts/nginx", version: "1.0.0", cred: cred, want: "1.0.0"},
+		{name: "tag in url", url: "oci://" + r.host + "/charts/nginx:1.0.0", cred: cred, want: "1.0.0"},
+		{name: "version takes precedence", url: "oci://" + r.host + "/charts/nginx:1.0.0", version: "1.1.0+build.1", cred: cred, want: "1.1.0+build.1"},
+		{name: "version is required", url: "oci://" + r.host + "/charts/nginx", cred: cred, wantErr: true},
+		{name: "tag not found", url: "oci://" + r.host + "/charts/nginx", version: "2.0.0", cred: cred, wantErr: true},
+		{name: "without credentials", url: "oci://" + r.host + "/charts/nginx", version: "1.0.0", wantErr: true},
+		{name: "wrong credentials", url: "oci://" + r.host + "/charts/nginx", version: "1.0.0", cred: &Credentials{Username: "user"}, wantErr: true},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			data, err := f.FetchWithCredentials(arg.url, arg.version, arg.cred)
+			if (err != nil) != arg.wantErr {
+				t.Fatalf("expect error %v, but got %v", arg.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			chrt, err := loader.LoadArchive(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatalf("load chart failed: %v", err)
+			}
+			if chrt.Metadata.Version != arg.want {
+				t.Errorf("expect version %s, but got %s", arg.want, chrt.Metadata.Version)
+			}
+		})
+	}
+}
+
+func TestChartFetcherOCICache(t *testing.T) {
+	r := newTestRegistry(t, "charts/nginx", "user", "pass", "1.0.0")
+	f := newTestChartFetcher(t)
+	cred := &Credentials{Username: "user", Password: "pass"}
+	chartURL := "oci://" + r.host + "/charts/nginx"
+
+	for i := 0; i < 3; i++ {
+		if _, err := f.FetchWithCredentials(chartURL, "1.0.0", cred); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	}
+	if c := atomic.LoadInt32(&r.blobCount); c != 1 {
+		t.Errorf("chart should be pulled once in IndexTTL, but pulled %d times", c)
+	}
+	if c := atomic.LoadInt32(&r.manifestCount); c == 0 || c > 2 {
+		t.Errorf("manifest should be resolved once in IndexTTL, but requested %d times", c)
+	}
+
+	// the tag is pushed again, it is pulled after IndexTTL
+	r.charts["1.0.0"] = append(newTestChartPackage(t, "nginx", "1.0.0"), 0)
+	if data, err := f.FetchWithCredentials(chartURL, "1.0.0", cred); err != nil || sha256Hex(data) == sha256Hex(r.charts["1.0.0"]) {
+		t.Errorf("cached chart should be used in IndexTTL, err: %v", err)
+	}
+	f.now = func() time.Time { return time.Now().Add(f.IndexTTL) }
+	data, err := f.FetchWithCredentials(chartURL, "1.0.0", cred)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if c := atomic.LoadInt32(&r.blobCount); c != 2 || sha256Hex(data) != sha256Hex(r.charts["1.0.0"]) {
+		t.Errorf("the new digest of tag should be pulled, pulled %d times", c)
+	}
+
+	// registry is down, use cache
+	r.Close()
+	f.now = func() time.Time { return time.Now().Add(f.IndexTTL * 2) }
+	if _, err := f.FetchWithCredentials(chartURL, "1.0.0", cred); err != nil {
+		t.Errorf("cached chart should be used when registry is down: %v", err)
+	}
+	if _, err := f.FetchWithCredentials(chartURL, "1.1.0", cred); err == nil {
+		t.Errorf("expect error when registry is down and no cache")
+	}
+}
@@ -0,0 +1,60 @@
+package helm
+
+import (
+	"sort"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// SortByInstallOrder sort objects by kind as helm install does, such as namespaces, CRDs, RBAC,
+// config, services, then workloads. Unknown kinds are at the end in kind name order, objects with
+// the same kind keep the original order.
+func SortByInstallOrder(objs []K8sObject) {
+	sort.SliceStable(objs, func(i, j int) bool {
+		return InstallOrderLess(objs[i].GroupKind().Kind, objs[j].GroupKind().Kind)
+	})
+}
+
+// SortByUninstallOrder sort objects by kind in the reverse of install order, objects with the same
+// kind keep the original order.
+func SortByUninstallOrder(objs []K8sObject) {
+	sort.SliceStable(objs, func(i, j int) bool {
+		return UninstallOrderLess(objs[i].GroupKind().Kind, objs[j].GroupKind().Kind)
+	})
+}
+
+// InstallOrderLess returns whether kind a should be installed before kind b
+func InstallOrderLess(a, b string) bool {
+	return kindLess(releaseutil.InstallOrder, a, b)
+}
+
+// UninstallOrderLess returns whether kind a should be uninstalled before kind b
+func UninstallOrderLess(a, b string) bool {
+	return kindLess(releaseutil.InstallOrder, b, a)
+}
+
+func kindLess(order releaseutil.KindSortOrder, a, b string) bool {
+	if a == b {
+		return false
+	}
+	ia, aok := kindIndex(order, a)
+	ib, bok := kindIndex(order, b)
+	switch {
+	case aok && bok:
+		return ia < ib
+	case aok:
+		return true
+	case bok:
+		return false
+	}
+	return a < b
+}
+
+func kindIndex(order releaseutil.KindSortOrder, kind string) (int, bool) {
+	for i, k := range order {
+		if k == kind {
+			return i, true
+		}
+	}
+	return 0, false
+}
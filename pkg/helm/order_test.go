@@ -0,0 +1,71 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newKindObjects(kinds ...string) []K8sObject {
+	objs := make([]K8sObject, 0, len(kinds))
+	for i, kind := range kinds {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind(kind)
+		u.SetName(string(rune('a' + i)))
+		objs = append(objs, NewK8sObject(u, nil, nil))
+	}
+	return objs
+}
+
+func objectKinds(objs []K8sObject) []string {
+	kinds := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		kinds = append(kinds, obj.GroupKind().Kind+"/"+obj.GetName())
+	}
+	return kinds
+}
+
+func TestSortByInstallOrder(t *testing.T) {
+	args := []struct {
+		name      string
+		kinds     []string
+		install   []string
+		uninstall []string
+	}{
+		{
+			name:      "empty",
+			kinds:     []string{},
+			install:   []string{},
+			uninstall: []string{},
+		},
+		{
+			name:      "known kinds",
+			kinds:     []string{"Deployment", "Service", "ConfigMap", "ServiceAccount", "Namespace"},
+			install:   []string{"Namespace/e", "ServiceAccount/d", "ConfigMap/c", "Service/b", "Deployment/a"},
+			uninstall: []string{"Deployment/a", "Service/b", "ConfigMap/c", "ServiceAccount/d", "Namespace/e"},
+		},
+		{
+			name:      "unknown kinds and same kind",
+			kinds:     []string{"Foo", "Deployment", "Bar", "Secret", "Deployment"},
+			install:   []string{"Secret/d", "Deployment/b", "Deployment/e", "Bar/c", "Foo/a"},
+			uninstall: []string{"Foo/a", "Bar/c", "Deployment/b", "Deployment/e", "Secret/d"},
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			objs := newKindObjects(arg.kinds...)
+			SortByInstallOrder(objs)
+			if got := objectKinds(objs); !reflect.DeepEqual(got, arg.install) {
+				t.Errorf("install order expect %v, but got %v", arg.install, got)
+			}
+
+			objs = newKindObjects(arg.kinds...)
+			SortByUninstallOrder(objs)
+			if got := objectKinds(objs); !reflect.DeepEqual(got, arg.uninstall) {
+				t.Errorf("uninstall order expect %v, but got %v", arg.uninstall, got)
+			}
+		})
+	}
+}
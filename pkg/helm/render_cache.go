@@ -0,0 +1,182 @@
+package helm
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/symcn/pkg/metrics"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+var (
+	renderCacheMetricPre = "helm_render_cache_"
+
+	lookupFuncRegexp = regexp.MustCompile(`\blookup\b`)
+)
+
+// render cache metrics key
+const (
+	RenderCacheHitTotal  = "hit_total"
+	RenderCacheMissTotal = "miss_total"
+	RenderCacheEntries   = "entries"
+)
+
+// RenderCache is a LRU cache of the rendered objects, keyed by everything the result depends on,
+// so a chart is rendered again only when something changed. Charts calling lookup depend on the
+// cluster, they are always rendered.
+type RenderCache struct {
+	size int
+
+	lock  sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	hit     prometheus.Counter
+	miss    prometheus.Counter
+	entries prometheus.Gauge
+}
+
+type renderCacheEntry struct {
+	key     string
+	objects []K8sObject
+	// lookup means the chart templates call lookup, objects are not cached
+	lookup bool
+}
+
+// NewRenderCache build RenderCache holds size render results at most, size 0 means disabled
+func NewRenderCache(size int) (*RenderCache, error) {
+	metric, err := metrics.NewMetrics(renderCacheMetricPre, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderCache{
+		size:    size,
+		ll:      list.New(),
+		items:   map[string]*list.Element{},
+		hit:     metric.Counter(RenderCacheHitTotal),
+		miss:    metric.Counter(RenderCacheMissTotal),
+		entries: metric.Gauge(RenderCacheEntries),
+	}, nil
+}
+
+// RenderTemplate returns the cached objects if chart and its inputs are the same as before,
+// otherwise render with RenderTemplate and cache the result. Errors and the objects of charts
+// calling lookup are never cached.
+func (c *RenderCache) RenderTemplate(chartPkg []byte, rlsName, ns string, overrideValue string, caps *chartutil.Capabilities, lookup *rest.Config) ([]K8sObject, error) {
+	if c.size <= 0 {
+		return RenderTemplate(chartPkg, rlsName, ns, overrideValue, caps, lookup)
+	}
+
+	key := renderCacheKey(chartPkg, rlsName, ns, overrideValue, caps)
+	if entry, ok := c.get(key); ok {
+		if entry.lookup {
+			return RenderTemplate(chartPkg, rlsName, ns, overrideValue, caps, lookup)
+		}
+		c.hit.Inc()
+		klog.V(5).Infof("Render cache hit release %s/%s", ns, rlsName)
+		return entry.objects, nil
+	}
+	c.miss.Inc()
+
+	objects, err := RenderTemplate(chartPkg, rlsName, ns, overrideValue, caps, lookup)
+	if err != nil {
+		return nil, err
+	}
+	if chartCallsLookup(chartPkg) {
+		c.add(&renderCacheEntry{key: key, lookup: true})
+		return objects, nil
+	}
+	c.add(&renderCacheEntry{key: key, objects: objects})
+	return copyK8sObjects(objects), nil
+}
+
+// get returns a copy of the entry of key
+func (c *RenderCache) get(key string) (*renderCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	entry := e.Value.(*renderCacheEntry)
+	return &renderCacheEntry{key: key, objects: copyK8sObjects(entry.objects), lookup: entry.lookup}, true
+}
+
+func (c *RenderCache) add(entry *renderCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if e, ok := c.items[entry.key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value = entry
+		return
+	}
+	c.items[entry.key] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*renderCacheEntry).key)
+	}
+	c.entries.Set(float64(c.ll.Len()))
+}
+
+// renderCacheKey is the digest of chart archive, release, namespace, values and capabilities
+func renderCacheKey(chartPkg []byte, rlsName, ns string, overrideValue string, caps *chartutil.Capabilities) string {
+	chartSum := sha256.Sum256(chartPkg)
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	write(hex.EncodeToString(chartSum[:]))
+	write(rlsName)
+	write(ns)
+	write(overrideValue)
+	if caps != nil {
+		write(caps.KubeVersion.Version)
+		for _, v := range caps.APIVersions {
+			write(v)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chartCallsLookup returns whether the templates of chart or its subcharts call lookup, the
+// chart which can not be loaded is treated as calling it.
+func chartCallsLookup(chartPkg []byte) bool {
+	chrt, err := loader.LoadArchive(bytes.NewReader(chartPkg))
+	if err != nil {
+		return true
+	}
+	charts := []*chart.Chart{chrt}
+	for len(charts) > 0 {
+		c := charts[0]
+		charts = append(charts[1:], c.Dependencies()...)
+		for _, tpl := range c.Templates {
+			if lookupFuncRegexp.Match(tpl.Data) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyK8sObjects deep copy objects, so the cached ones are not changed by callers
+func copyK8sObjects(objects []K8sObject) []K8sObject {
+	out := make([]K8sObject, 0, len(objects))
+	for _, o := range objects {
+		out = append(out, NewK8sObject(o.UnstructuredObject().DeepCopy(), nil, nil))
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/client-go/rest"
+)
+
+func TestRenderCache(t *testing.T) {
+	pkg := newTestChartPackage(t, "nginx", "1.0.0")
+	otherPkg := newTestChartPackage(t, "nginx", "1.1.0")
+	caps := chartutil.DefaultCapabilities.Copy()
+	caps.APIVersions = append(caps.APIVersions, "example.com/v1")
+
+	type render struct {
+		chartPkg []byte
+		rlsName  string
+		values   string
+		caps     *chartutil.Capabilities
+	}
+	args := []struct {
+		name       string
+		size       int
+		renders    []render
+		expectHit  float64
+		expectMiss float64
+	}{
+		{
+			name: "same inputs",
+			size: 10,
+			renders: []render{
+				{chartPkg: pkg, rlsName: "blue"},
+				{chartPkg: pkg, rlsName: "blue"},
+			},
+			expectHit:  1,
+			expectMiss: 1,
+		},
+		{
+			name: "inputs changed",
+			size: 10,
+			renders: []render{
+				{chartPkg: pkg, rlsName: "blue"},
+				{chartPkg: otherPkg, rlsName: "blue"},
+				{chartPkg: pkg, rlsName: "green"},
+				{chartPkg: pkg, rlsName: "blue", values: "a: b"},
+				{chartPkg: pkg, rlsName: "blue", caps: caps},
+			},
+			expectHit:  0,
+			expectMiss: 5,
+		},
+		{
+			name: "evict least recently used",
+			size: 1,
+			renders: []render{
+				{chartPkg: pkg, rlsName: "blue"},
+				{chartPkg: pkg, rlsName: "green"},
+				{chartPkg: pkg, rlsName: "blue"},
+			},
+			expectHit:  0,
+			expectMiss: 3,
+		},
+		{
+			name: "disabled",
+			size: 0,
+			renders: []render{
+				{chartPkg: pkg, rlsName: "blue"},
+				{chartPkg: pkg, rlsName: "blue"},
+			},
+			expectHit:  0,
+			expectMiss: 0,
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			c, err := NewRenderCache(arg.size)
+			if err != nil {
+				t.Fatalf("new render cache failed: %v", err)
+			}
+			hit, miss := testutil.ToFloat64(c.hit), testutil.ToFloat64(c.miss)
+
+			for _, r := range arg.renders {
+				objs, err := c.RenderTemplate(r.chartPkg, r.rlsName, "default", r.values, r.caps, nil)
+				if err != nil {
+					t.Fatalf("render failed: %v", err)
+				}
+				if len(objs) != 1 || objs[0].GetName() != r.rlsName {
+					t.Fatalf("expect ConfigMap %s, but got %v", r.rlsName, objs)
+				}
+			}
+			if got := testutil.ToFloat64(c.hit) - hit; got != arg.expectHit {
+				t.Errorf("expect hit %v, but got %v", arg.expectHit, got)
+			}
+			if got := testutil.ToFloat64(c.miss) - miss; got != arg.expectMiss {
+				t.Errorf("expect miss %v, but got %v", arg.expectMiss, got)
+			}
+		})
+	}
+}
+
+func TestRenderCacheCopy(t *testing.T) {
+	pkg := newTestChartPackage(t, "nginx", "1.0.0")
+	c, err := NewRenderCache(10)
+	if err != nil {
+		t.Fatalf("new render cache failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		objs, err := c.RenderTemplate(pkg, "blue", "default", "", nil, nil)
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		if labels := objs[0].GetLabels(); labels["changed"] != "" {
+			t.Fatalf("expect cached object not changed, but got labels %v", labels)
+		}
+		objs[0].AddLabels(map[string]string{"changed": "true"})
+	}
+}
+
+func TestRenderCacheLookup(t *testing.T) {
+	server := newTestAPIServer(t)
+	pkg := newLookupChartPackage(t)
+	c, err := NewRenderCache(10)
+	if err != nil {
+		t.Fatalf("new render cache failed: %v", err)
+	}
+	hit := testutil.ToFloat64(c.hit)
+
+	// the objects depend on the cluster, they are never cached
+	args := []struct {
+		lookup *rest.Config
+		expect string
+	}{
+		{lookup: NewLookupConfig(&rest.Config{Host: server.URL}, "default"), expect: "ZXhpc3Rpbmc="},
+		{lookup: nil, expect: "generated"},
+		{lookup: NewLookupConfig(&rest.Config{Host: server.URL}, "default"), expect: "ZXhpc3Rpbmc="},
+	}
+	for i, arg := range args {
+		objs, err := c.RenderTemplate(pkg, "app", "default", "", nil, arg.lookup)
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		if got := objs[0].UnstructuredObject().Object["data"].(map[string]interface{})["current"]; got != arg.expect {
+			t.Errorf("render %d expect %s, but got %v", i, arg.expect, got)
+		}
+	}
+	if got := testutil.ToFloat64(c.hit) - hit; got != 0 {
+		t.Errorf("chart calling lookup should not hit cache, but hit %v", got)
+	}
+}
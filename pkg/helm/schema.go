@@ -0,0 +1,108 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+const schemaRootField = "(root)"
+
+// SchemaViolation is a value not meeting the values.schema.json of chart
+type SchemaViolation struct {
+	// Chart is the name of the chart or subchart the schema belongs to
+	Chart string
+	// Path is the path of the value from the top level values, such as image.tag
+	Path string
+	// Description is why the value is invalid
+	Description string
+}
+
+// SchemaError is returned when the values don't meet the chart schema
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", v.Path, v.Description))
+	}
+	return "values don't meet the chart schema: " + strings.Join(msgs, "; ")
+}
+
+// ValidateValuesSchema checks the coalesced values against values.schema.json of chart and its
+// dependencies, a *SchemaError lists all the violations.
+func ValidateValuesSchema(chrt *chart.Chart, values map[string]interface{}) error {
+	var violations []SchemaViolation
+	if err := validateValuesSchema(chrt, values, "", &violations); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &SchemaError{Violations: violations}
+	}
+	return nil
+}
+
+func validateValuesSchema(chrt *chart.Chart, values map[string]interface{}, prefix string, violations *[]SchemaViolation) error {
+	if chrt.Schema != nil {
+		valuesJSON, err := yaml.Marshal(values)
+		if err != nil {
+			return err
+		}
+		if valuesJSON, err = yaml.YAMLToJSON(valuesJSON); err != nil {
+			return err
+		}
+		if bytes.Equal(valuesJSON, []byte("null")) {
+			valuesJSON = []byte("{}")
+		}
+		result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(chrt.Schema), gojsonschema.NewBytesLoader(valuesJSON))
+		if err != nil {
+			return fmt.Errorf("load chart %s values schema failed: %v", chrt.Name(), err)
+		}
+		// errors are in random order, sort them so the reported message is stable
+		var chartViolations []SchemaViolation
+		for _, e := range result.Errors() {
+			chartViolations = append(chartViolations, SchemaViolation{
+				Chart:       chrt.Name(),
+				Path:        schemaPath(prefix, e.Field()),
+				Description: e.Description(),
+			})
+		}
+		sort.Slice(chartViolations, func(i, j int) bool {
+			if chartViolations[i].Path != chartViolations[j].Path {
+				return chartViolations[i].Path < chartViolations[j].Path
+			}
+			return chartViolations[i].Description < chartViolations[j].Description
+		})
+		*violations = append(*violations, chartViolations...)
+	}
+
+	for _, subchart := range chrt.Dependencies() {
+		subchartValues, _ := values[subchart.Name()].(map[string]interface{})
+		if err := validateValuesSchema(subchart, subchartValues, schemaPath(prefix, subchart.Name()), violations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaPath(prefix, field string) string {
+	if field == schemaRootField {
+		field = ""
+	}
+	switch {
+	case prefix == "" && field == "":
+		return schemaRootField
+	case prefix == "":
+		return field
+	case field == "":
+		return prefix
+	}
+	return prefix + "." + field
+}
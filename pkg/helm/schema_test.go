@@ -0,0 +1,116 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func newSchemaChartPackage(t *testing.T) []byte {
+	sub := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "redis", Version: "0.1.0"},
+		Schema:   []byte(`{"type":"object","properties":{"port":{"type":"integer"}}}`),
+		Values:   map[string]interface{}{"port": 6379},
+	}
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "app", Version: "0.1.0"},
+		Schema: []byte(`{
+  "type": "object",
+  "required": ["image"],
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "image": {
+      "type": "object",
+      "required": ["repository"],
+      "properties": {"repository": {"type": "string"}, "tag": {"type": "string"}}
+    }
+  }
+}`),
+		Values: map[string]interface{}{"replicas": 1},
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n"),
+			},
+		},
+	}
+	chrt.AddDependency(sub)
+	return saveTestChart(t, chrt)
+}
+
+func TestRenderTemplateWithSchema(t *testing.T) {
+	pkg := newSchemaChartPackage(t)
+
+	args := []struct {
+		name   string
+		values string
+		expect []SchemaViolation
+	}{
+		{
+			name:   "valid",
+			values: "image:\n  repository: nginx\n  tag: \"1.21\"\n",
+		},
+		{
+			name:   "required",
+			values: "replicas: 2\n",
+			expect: []SchemaViolation{
+				{Chart: "app", Path: "(root)", Description: "image is required"},
+			},
+		},
+		{
+			name:   "invalid values",
+			values: "replicas: 0\nimage:\n  repository: nginx\n  tag: 1\nredis:\n  port: \"6379\"\n",
+			expect: []SchemaViolation{
+				{Chart: "app", Path: "image.tag", Description: "Invalid type. Expected: string, given: integer"},
+				{Chart: "app", Path: "replicas", Description: "Must be greater than or equal to 1"},
+				{Chart: "redis", Path: "redis.port", Description: "Invalid type. Expected: integer, given: string"},
+			},
+		},
+	}
+
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			_, err := RenderTemplate(pkg, "app", "default", arg.values, nil, nil)
+			if arg.expect == nil {
+				if err != nil {
+					t.Errorf("expect no error, but got %v", err)
+				}
+				return
+			}
+			schemaErr, ok := err.(*SchemaError)
+			if !ok {
+				t.Fatalf("expect schema error, but got %v", err)
+			}
+			if !reflect.DeepEqual(schemaErr.Violations, arg.expect) {
+				t.Errorf("expect %v, but got %v", arg.expect, schemaErr.Violations)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateSymValuesNotValidated(t *testing.T) {
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "app", Version: "0.1.0"},
+		Schema:   []byte(`{"type":"object","additionalProperties":false,"properties":{"replicas":{"type":"integer"}}}`),
+		Values:   map[string]interface{}{"replicas": 1},
+		Templates: []*chart.File{
+			{
+				Name: "templates/configmap.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}-{{ .Values.sym.podSetName }}\n"),
+			},
+		},
+	}
+	pkg := saveTestChart(t, chrt)
+
+	objs, err := RenderTemplate(pkg, "app", "default", "replicas: 2\nsym:\n  podSetName: blue\n", nil, nil)
+	if err != nil {
+		t.Fatalf("sym values should not be validated, but got %v", err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "app-blue" {
+		t.Errorf("expect configmap app-blue, but got %v", objs)
+	}
+	if _, err = RenderTemplate(pkg, "app", "default", "unknown: 1\n", nil, nil); err == nil {
+		t.Errorf("expect schema error of additional properties")
+	}
+}
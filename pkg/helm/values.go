@@ -0,0 +1,20 @@
+package helm
+
+// MergeValues deep merge src over dst like helm merges multiple values files, src takes
+// precedence. Unlike chartutil.CoalesceTables, null in src is kept, so that it still removes the
+// key from chart default values when rendering.
+func MergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = map[string]interface{}{}
+	}
+	for k, v := range src {
+		if srcTable, ok := v.(map[string]interface{}); ok {
+			if dstTable, ok := dst[k].(map[string]interface{}); ok {
+				dst[k] = MergeValues(dstTable, srcTable)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,154 @@
+package kustomize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/symcn/sym-ops/pkg/helm"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	baseDir    = "/base"
+	overlayDir = "/overlays"
+
+	kustomizationFile = "kustomization.yaml"
+)
+
+// Overlay is the kustomization generated for a podSet on top of the kustomization in tarball
+type Overlay struct {
+	// Name is the overlay name, one overlay per podSet
+	Name string
+	// Namespace of all the resources
+	Namespace string
+	// NameSuffix is appended to the names of all the resources
+	NameSuffix string
+	// CommonLabels are added to all the resources, selectors and pod templates
+	CommonLabels map[string]string
+
+	// Patches, Images and Replicas refer to the resources by the names in tarball
+	Patches  []types.Patch
+	Images   []types.Image
+	Replicas []types.Replica
+}
+
+// Render build the kustomization at kustomizePath of the gzipped tarball with overlay, empty
+// kustomizePath means the root of tarball. The objects are returned in install order.
+func Render(tarball []byte, kustomizePath string, overlay *Overlay) ([]helm.K8sObject, error) {
+	fSys := filesys.MakeFsInMemory()
+	if err := extractTarball(fSys, tarball, baseDir); err != nil {
+		return nil, fmt.Errorf("loading kustomization has an error: %v", err)
+	}
+
+	target := path.Join(baseDir, path.Clean("/"+kustomizePath))
+	if overlay != nil {
+		dir, err := writeOverlay(fSys, target, overlay)
+		if err != nil {
+			return nil, err
+		}
+		target = dir
+	}
+
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fSys, target)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build %s has an error: %v", kustomizePath, err)
+	}
+	manifests, err := resMap.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("kustomize output to yaml has an error: %v", err)
+	}
+	objs, err := helm.ParseYAML2K8sObjects(manifests)
+	if err != nil {
+		return nil, err
+	}
+	helm.SortByInstallOrder(objs)
+	return objs, nil
+}
+
+// writeOverlay write the overlay kustomization referencing target, returns its directory
+func writeOverlay(fSys filesys.FileSystem, target string, overlay *Overlay) (string, error) {
+	dir := path.Join(overlayDir, overlay.Name)
+	base, err := filepath.Rel(dir, target)
+	if err != nil {
+		return "", err
+	}
+	kustomization := map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"resources":  []string{base},
+	}
+	if overlay.Namespace != "" {
+		kustomization["namespace"] = overlay.Namespace
+	}
+	if overlay.NameSuffix != "" {
+		kustomization["nameSuffix"] = overlay.NameSuffix
+	}
+	if len(overlay.CommonLabels) > 0 {
+		kustomization["commonLabels"] = overlay.CommonLabels
+	}
+	if len(overlay.Patches) > 0 {
+		kustomization["patches"] = overlay.Patches
+	}
+	if len(overlay.Images) > 0 {
+		kustomization["images"] = overlay.Images
+	}
+	if len(overlay.Replicas) > 0 {
+		kustomization["replicas"] = overlay.Replicas
+	}
+	data, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return "", err
+	}
+	if err = fSys.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	return dir, fSys.WriteFile(path.Join(dir, kustomizationFile), data)
+}
+
+// extractTarball write the regular files of the gzipped tarball to dir of fSys
+func extractTarball(fSys filesys.FileSystem, tarball []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(tarball))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("illegal file path %s in tarball", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		file := path.Join(dir, name)
+		if err = fSys.MkdirAll(path.Dir(file)); err != nil {
+			return err
+		}
+		if err = fSys.WriteFile(file, data); err != nil {
+			return err
+		}
+	}
+}
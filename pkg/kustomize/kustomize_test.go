@@ -0,0 +1,178 @@
+package kustomize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/symcn/sym-ops/pkg/helm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+var testFiles = map[string]string{
+	"base/kustomization.yaml": `resources:
+- deployment.yaml
+- service.yaml
+`,
+	"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: nginx:1.20
+`,
+	"base/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+`,
+	"overlays/rz/kustomization.yaml": `resources:
+- ../../base
+replicas:
+- name: app
+  count: 3
+`,
+}
+
+func newTestTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func findObject(objs []helm.K8sObject, kind string) *unstructured.Unstructured {
+	for _, obj := range objs {
+		if obj.GroupKind().Kind == kind {
+			return obj.UnstructuredObject()
+		}
+	}
+	return nil
+}
+
+func TestRender(t *testing.T) {
+	tarball := newTestTarball(t, testFiles)
+
+	t.Run("without overlay", func(t *testing.T) {
+		objs, err := Render(tarball, "base", nil)
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		if len(objs) != 2 || objs[0].GroupKind().Kind != "Service" {
+			t.Fatalf("expect Service and Deployment in install order, but got %v", objs)
+		}
+	})
+
+	t.Run("podSet overlay", func(t *testing.T) {
+		objs, err := Render(tarball, "overlays/rz", &Overlay{
+			Name:         "app-blue",
+			Namespace:    "default",
+			NameSuffix:   "-blue",
+			CommonLabels: map[string]string{"sym-podset": "app-blue"},
+		})
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		deploy := findObject(objs, "Deployment")
+		if deploy == nil {
+			t.Fatalf("expect Deployment, but got %v", objs)
+		}
+		if deploy.GetName() != "app-blue" || deploy.GetNamespace() != "default" {
+			t.Errorf("expect default/app-blue, but got %s/%s", deploy.GetNamespace(), deploy.GetName())
+		}
+		if replicas, _, _ := unstructured.NestedInt64(deploy.Object, "spec", "replicas"); replicas != 3 {
+			t.Errorf("expect replicas 3 of the cluster overlay, but got %d", replicas)
+		}
+		expect := map[string]string{"app": "app", "sym-podset": "app-blue"}
+		selector, _, _ := unstructured.NestedStringMap(deploy.Object, "spec", "selector", "matchLabels")
+		if !reflect.DeepEqual(selector, expect) {
+			t.Errorf("expect selector %v, but got %v", expect, selector)
+		}
+		svc := findObject(objs, "Service")
+		if svc == nil || svc.GetName() != "app-blue" {
+			t.Fatalf("expect Service app-blue, but got %v", svc)
+		}
+	})
+
+	t.Run("podSet patches images and replicas", func(t *testing.T) {
+		objs, err := Render(tarball, "base", &Overlay{
+			Name:       "app-blue",
+			NameSuffix: "-blue",
+			Patches: []types.Patch{
+				{Patch: "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  type: NodePort\n"},
+				{Patch: "- op: add\n  path: /metadata/annotations\n  value:\n    color: blue\n", Target: &types.Selector{ResId: resid.ResId{Gvk: resid.Gvk{Kind: "Deployment"}, Name: "app"}}},
+			},
+			Images:   []types.Image{{Name: "nginx", NewTag: "1.21"}},
+			Replicas: []types.Replica{{Name: "app", Count: 2}},
+		})
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		deploy := findObject(objs, "Deployment")
+		if deploy == nil || deploy.GetName() != "app-blue" {
+			t.Fatalf("expect Deployment app-blue, but got %v", deploy)
+		}
+		if replicas, _, _ := unstructured.NestedInt64(deploy.Object, "spec", "replicas"); replicas != 2 {
+			t.Errorf("expect replicas 2, but got %d", replicas)
+		}
+		if color := deploy.GetAnnotations()["color"]; color != "blue" {
+			t.Errorf("expect annotation color blue, but got %q", color)
+		}
+		containers, _, _ := unstructured.NestedSlice(deploy.Object, "spec", "template", "spec", "containers")
+		if len(containers) != 1 || containers[0].(map[string]interface{})["image"] != "nginx:1.21" {
+			t.Errorf("expect image nginx:1.21, but got %v", containers)
+		}
+		svc := findObject(objs, "Service")
+		if svcType, _, _ := unstructured.NestedString(svc.Object, "spec", "type"); svcType != "NodePort" {
+			t.Errorf("expect Service type NodePort, but got %q", svcType)
+		}
+	})
+
+	t.Run("path not found", func(t *testing.T) {
+		if _, err := Render(tarball, "overlays/gz", nil); err == nil {
+			t.Errorf("expect error, but got nil")
+		}
+	})
+
+	t.Run("illegal path", func(t *testing.T) {
+		_, err := Render(newTestTarball(t, map[string]string{"../kustomization.yaml": "resources: []\n"}), "", nil)
+		if err == nil || !strings.Contains(err.Error(), "illegal file path") {
+			t.Errorf("expect illegal file path error, but got %v", err)
+		}
+	})
+}
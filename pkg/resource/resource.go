@@ -14,6 +14,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
@@ -33,12 +34,22 @@ type Option struct {
 	DesiredState     DesiredState
 	IsRecreate       bool
 	IsIgnoreReplicas bool
+	// Namespace is used by namespaced unstructured object without namespace
+	Namespace string
 }
 
+// Reconcile make the desired object present or absent. Any kind could be reconciled as
+// unstructured.Unstructured with JSON merge three-way patch, the kind is resolved with RESTMapper.
+// The patch is sent instead of the whole object, so the fields filled by the server are kept.
 func Reconcile(ctx context.Context, cli api.MingleClient, desired rtclient.Object, opt Option) (bool, error) {
 	if opt.DesiredState == "" {
 		opt.DesiredState = DesiredStatePresent
 	}
+	if u, ok := desired.(*unstructured.Unstructured); ok {
+		if err := prepareUnstructured(cli.GetCtrlRtManager().GetRESTMapper(), u, opt.Namespace); err != nil {
+			return false, err
+		}
+	}
 
 	current := desired.DeepCopyObject().(rtclient.Object)
 	key := rtclient.ObjectKeyFromObject(desired)
@@ -91,6 +102,9 @@ func Reconcile(ctx context.Context, cli api.MingleClient, desired rtclient.Objec
 	if err = patch.DefaultAnnotator.SetLastAppliedAnnotation(desired); err != nil {
 		klog.Errorf("Set last applied annotation %s failed: %v", key, err)
 	}
+	if _, ok := desired.(*unstructured.Unstructured); ok {
+		return true, patchUnstructured(cli, current, desired, key, calcOpts)
+	}
 	if _, isJob := desired.(*batchv1.Job); isJob {
 		return true, updateOrDeleteAndCreateJob(cli, current, desired, key)
 	}
@@ -136,6 +150,20 @@ func patchHandle(current, desired rtclient.Object, key ktypes.NamespacedName, op
 	return calcOpts, false, nil
 }
 
+// patchUnstructured patch current with the JSON merge three-way patch of desired, which carries
+// the last applied annotation already.
+func patchUnstructured(cli api.MingleClient, current, desired rtclient.Object, key ktypes.NamespacedName, calcOpts []patch.CalculateOption) error {
+	patchResult, err := patch.DefaultPatchMaker.Calculate(current, desired, calcOpts...)
+	if err != nil {
+		return fmt.Errorf("Couldn't not match object %s err: %v", key, err)
+	}
+	if err = cli.Patch(desired, rtclient.RawPatch(ktypes.MergePatchType, patchResult.Patch)); err != nil {
+		return fmt.Errorf("Patch resource %s failed: %v", key, err)
+	}
+	klog.V(4).Infof("Patch resource %s successful.", key)
+	return nil
+}
+
 func updateOrDeleteAndCreateJob(cli api.MingleClient, current, desired rtclient.Object, key ktypes.NamespacedName) error {
 	err := cli.Update(desired)
 	if err == nil {
@@ -0,0 +1,107 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/symcn/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// fakeMingleClient is the MingleClient of a fake cluster, the methods not overridden panic
+type fakeMingleClient struct {
+	api.MingleClient
+	cli rtclient.Client
+}
+
+type fakeManager struct {
+	manager.Manager
+}
+
+func (m *fakeManager) GetRESTMapper() meta.RESTMapper {
+	return testrestmapper.TestOnlyStaticRESTMapper(clientgoscheme.Scheme)
+}
+
+func (f *fakeMingleClient) GetCtrlRtManager() manager.Manager {
+	return &fakeManager{}
+}
+
+func (f *fakeMingleClient) Get(key ktypes.NamespacedName, obj rtclient.Object) error {
+	return f.cli.Get(context.TODO(), key, obj)
+}
+
+func (f *fakeMingleClient) Create(obj rtclient.Object, opts ...rtclient.CreateOption) error {
+	return f.cli.Create(context.TODO(), obj, opts...)
+}
+
+func (f *fakeMingleClient) Update(obj rtclient.Object, opts ...rtclient.UpdateOption) error {
+	return f.cli.Update(context.TODO(), obj, opts...)
+}
+
+func (f *fakeMingleClient) Patch(obj rtclient.Object, patch rtclient.Patch, opts ...rtclient.PatchOption) error {
+	return f.cli.Patch(context.TODO(), obj, patch, opts...)
+}
+
+func newUnstructuredPVC(labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata": map[string]interface{}{
+			"name": "data",
+		},
+		"spec": map[string]interface{}{
+			"accessModes": []interface{}{"ReadWriteOnce"},
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{"storage": "1Gi"},
+			},
+		},
+	}}
+	u.SetLabels(labels)
+	return u
+}
+
+func TestReconcileUnstructuredKeepServerFields(t *testing.T) {
+	cli := &fakeMingleClient{cli: fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()}
+	opt := Option{Namespace: "default"}
+
+	if _, err := Reconcile(context.TODO(), cli, newUnstructuredPVC(map[string]string{"color": "blue"}), opt); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	// the server binds the claim
+	pvc := &corev1.PersistentVolumeClaim{}
+	key := ktypes.NamespacedName{Namespace: "default", Name: "data"}
+	if err := cli.Get(key, pvc); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	pvc.Spec.VolumeName = "pv-data"
+	pvc.Annotations["pv.kubernetes.io/bind-completed"] = "yes"
+	if err := cli.Update(pvc); err != nil {
+		t.Fatalf("bind failed: %v", err)
+	}
+
+	if _, err := Reconcile(context.TODO(), cli, newUnstructuredPVC(map[string]string{"color": "blue"}), opt); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	pvc = &corev1.PersistentVolumeClaim{}
+	if err := cli.Get(key, pvc); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if pvc.Labels["color"] != "blue" {
+		t.Errorf("expect label color blue, but got %v", pvc.Labels)
+	}
+	if pvc.Spec.VolumeName != "pv-data" {
+		t.Errorf("expect volumeName pv-data filled by server kept, but got %q", pvc.Spec.VolumeName)
+	}
+	if pvc.Annotations["pv.kubernetes.io/bind-completed"] != "yes" {
+		t.Errorf("expect annotation filled by server kept, but got %v", pvc.Annotations)
+	}
+}
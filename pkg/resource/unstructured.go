@@ -0,0 +1,35 @@
+package resource
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// prepareUnstructured resolve the unstructured object with RESTMapper, the kind must be served by
+// the cluster. Namespaced object without namespace uses defaultNamespace, the namespace of cluster
+// scoped object is removed.
+func prepareUnstructured(mapper meta.RESTMapper, obj *unstructured.Unstructured, defaultNamespace string) error {
+	gvk := obj.GroupVersionKind()
+	if gvk.Kind == "" || gvk.Version == "" {
+		return fmt.Errorf("resource %s/%s apiVersion and kind is required", obj.GetNamespace(), obj.GetName())
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return fmt.Errorf("resource %s %s/%s is not served: %v", gvk, obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		obj.SetNamespace("")
+		return nil
+	}
+	if obj.GetNamespace() == "" {
+		if defaultNamespace == "" {
+			return fmt.Errorf("resource %s %s is namespaced, but namespace is empty", gvk, obj.GetName())
+		}
+		obj.SetNamespace(defaultNamespace)
+	}
+	return nil
+}
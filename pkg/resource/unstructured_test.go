@@ -0,0 +1,85 @@
+package resource
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestPrepareUnstructured(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	args := []struct {
+		name       string
+		apiVersion string
+		kind       string
+		namespace  string
+		defaultNs  string
+		wantNs     string
+		wantErr    bool
+	}{
+		{
+			name:       "namespaced with namespace",
+			apiVersion: "v1",
+			kind:       "ConfigMap",
+			namespace:  "ns1",
+			defaultNs:  "default",
+			wantNs:     "ns1",
+		},
+		{
+			name:       "namespaced without namespace",
+			apiVersion: "v1",
+			kind:       "ConfigMap",
+			defaultNs:  "default",
+			wantNs:     "default",
+		},
+		{
+			name:       "namespaced without any namespace",
+			apiVersion: "v1",
+			kind:       "ConfigMap",
+			wantErr:    true,
+		},
+		{
+			name:       "cluster scoped",
+			apiVersion: "rbac.authorization.k8s.io/v1",
+			kind:       "ClusterRole",
+			namespace:  "ns1",
+			defaultNs:  "default",
+			wantNs:     "",
+		},
+		{
+			name:       "kind not served",
+			apiVersion: "example.com/v1",
+			kind:       "Foo",
+			defaultNs:  "default",
+			wantErr:    true,
+		},
+		{
+			name:      "kind is empty",
+			defaultNs: "default",
+			wantErr:   true,
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(arg.apiVersion)
+			obj.SetKind(arg.kind)
+			obj.SetName("name")
+			obj.SetNamespace(arg.namespace)
+
+			err := prepareUnstructured(mapper, obj, arg.defaultNs)
+			if (err != nil) != arg.wantErr {
+				t.Errorf("expect error %v, but got %v", arg.wantErr, err)
+				return
+			}
+			if err == nil && obj.GetNamespace() != arg.wantNs {
+				t.Errorf("expect namespace %q, but got %q", arg.wantNs, obj.GetNamespace())
+			}
+		})
+	}
+}
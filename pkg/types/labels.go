@@ -39,6 +39,12 @@ var (
 	ServiceNameSuffix = "-svc"
 
 	LabelKeyZone = "sym-available-zone"
+
+	// LabelKeyPodSetName is stamped on the rendered objects with the podSet name
+	LabelKeyPodSetName = "sym-podset"
+
+	// LabelKeyCopiedFromMaster marks the ConfigMaps and Secrets copied by AppSet master
+	LabelKeyCopiedFromMaster = "sym-copied-from-master"
 )
 
 // annotation
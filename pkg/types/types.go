@@ -14,6 +14,7 @@ const (
 	ServiceKind       = "Service"
 	DeploymentKind    = "Deployment"
 	StatefulSetKind   = "StatefulSet"
+	ReplicaSetKind    = "ReplicaSet"
 	JobKind           = "Job"
 	AppsetKind        = "Appset"
 	AdvdeploymentKind = "Advdeployment"
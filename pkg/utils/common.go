@@ -77,6 +77,54 @@ func GetPodContainerImageVersion(containerName string, podSpec *corev1.PodSpec)
 	return ""
 }
 
+// SetPodContainerImageVersion override podSpec specify container image and version, returns
+// false if the container not found.
+// 1. image and version both not empty, use image:version
+// 2. only image not empty, use image, keep the current version if image has no tag or digest
+// 3. only version not empty, replace the tag of current image with version
+func SetPodContainerImageVersion(containerName string, podSpec *corev1.PodSpec, image, version string) bool {
+	if podSpec == nil {
+		return false
+	}
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if !strings.EqualFold(container.Name, containerName) {
+			continue
+		}
+
+		repo, suffix := splitImage(container.Image)
+		switch {
+		case image != "" && version != "":
+			r, _ := splitImage(image)
+			container.Image = r + ":" + version
+		case image != "":
+			if _, s := splitImage(image); s == "" {
+				container.Image = image + suffix
+			} else {
+				container.Image = image
+			}
+		case version != "":
+			container.Image = repo + ":" + version
+		}
+		return true
+	}
+	return false
+}
+
+// splitImage split image to repository and the tag or digest with separator
+// exp: registry:5000/app:v1 => registry:5000/app, :v1
+func splitImage(image string) (repo, suffix string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i:]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, ""
+	}
+	return image[:i], image[i:]
+}
+
 // TransInt32Ptr2Int32 transform *int32 to int32 with default value.
 func TransInt32Ptr2Int32(i *int32, def int32) int32 {
 	if i == nil {
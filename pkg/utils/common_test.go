@@ -424,3 +424,77 @@ func TestTransInt32PtrInt32(t *testing.T) {
 		})
 	}
 }
+
+func TestSetPodContainerImageVersion(t *testing.T) {
+	type input struct {
+		image   string
+		version string
+	}
+	args := []struct {
+		name    string
+		current string
+		input   input
+		want    string
+	}{
+		{
+			name:    "image and version",
+			current: "image:v1",
+			input:   input{image: "registry:5000/other:v3", version: "v2"},
+			want:    "registry:5000/other:v2",
+		},
+		{
+			name:    "only version",
+			current: "registry:5000/image:v1",
+			input:   input{version: "v2"},
+			want:    "registry:5000/image:v2",
+		},
+		{
+			name:    "only version replace digest",
+			current: "image@sha256:abc",
+			input:   input{version: "v2"},
+			want:    "image:v2",
+		},
+		{
+			name:    "only image without tag keep current tag",
+			current: "image:v1",
+			input:   input{image: "registry:5000/image"},
+			want:    "registry:5000/image:v1",
+		},
+		{
+			name:    "only image with tag",
+			current: "image:v1",
+			input:   input{image: "registry:5000/image:v3"},
+			want:    "registry:5000/image:v3",
+		},
+		{
+			name:    "both empty",
+			current: "image:v1",
+			input:   input{},
+			want:    "image:v1",
+		},
+	}
+
+	for _, ut := range args {
+		t.Run(ut.name, func(t *testing.T) {
+			podSpec := &corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "sidecar", Image: "sidecar:v1"},
+					{Name: "app", Image: ut.current},
+				},
+			}
+			if !SetPodContainerImageVersion("app", podSpec, ut.input.image, ut.input.version) {
+				t.Error("container app should be found")
+			}
+			if podSpec.Containers[1].Image != ut.want {
+				t.Errorf("input (%s, %s), expect %s but got %s", ut.input.image, ut.input.version, ut.want, podSpec.Containers[1].Image)
+			}
+			if podSpec.Containers[0].Image != "sidecar:v1" {
+				t.Errorf("sidecar container image should not be modified, but got %s", podSpec.Containers[0].Image)
+			}
+		})
+	}
+
+	if SetPodContainerImageVersion("app", nil, "image", "v1") {
+		t.Error("podSpec is nil, should return false")
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// default keys of the referenced ConfigMap or Secret
+var (
+	DefaultChartKey     = "chart.tgz"
+	DefaultValuesKey    = "values.yaml"
+	DefaultManifestsKey = "manifests.yaml"
+)
+
+// GetReferencedObject get the ConfigMap or Secret selected by selector, it is read from
+// apiserver directly rather than watching all ConfigMaps and Secrets.
+func GetReferencedObject(kubeCli kubernetes.Interface, namespace string, selector *workloadv1beta1.ResourceKeySelector) (rtclient.Object, error) {
+	switch selector.Kind {
+	case workloadv1beta1.ResourceKindConfigMap:
+		cm, err := kubeCli.CoreV1().ConfigMaps(namespace).Get(context.TODO(), selector.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return cm, nil
+	case workloadv1beta1.ResourceKindSecret:
+		secret, err := kubeCli.CoreV1().Secrets(namespace).Get(context.TODO(), selector.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return secret, nil
+	}
+	return nil, fmt.Errorf("referenced kind %s is not supported", selector.Kind)
+}
+
+// GetReferencedData returns the data of selector.Key in the referenced ConfigMap or Secret,
+// defKey is used when selector.Key is empty.
+func GetReferencedData(kubeCli kubernetes.Interface, namespace string, selector *workloadv1beta1.ResourceKeySelector, defKey string) ([]byte, error) {
+	obj, err := GetReferencedObject(kubeCli, namespace, selector)
+	if err != nil {
+		return nil, fmt.Errorf("get %s %s/%s failed: %v", selector.Kind, namespace, selector.Name, err)
+	}
+
+	key := selector.Key
+	if key == "" {
+		key = defKey
+	}
+	data, ok := ReferencedObjectData(obj, key)
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s has no key %s", selector.Kind, namespace, selector.Name, key)
+	}
+	return data, nil
+}
+
+// ReferencedObjectData returns the data of key in ConfigMap binaryData, data or Secret data
+func ReferencedObjectData(obj rtclient.Object, key string) ([]byte, bool) {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		if data, ok := o.BinaryData[key]; ok {
+			return data, true
+		}
+		if data, ok := o.Data[key]; ok {
+			return []byte(data), true
+		}
+	case *corev1.Secret:
+		if data, ok := o.Data[key]; ok {
+			return data, true
+		}
+	}
+	return nil, false
+}
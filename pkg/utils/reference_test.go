@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetReferencedData(t *testing.T) {
+	kubeCli := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-chart", Namespace: "default"},
+			BinaryData: map[string][]byte{DefaultChartKey: []byte("chart")},
+			Data:       map[string]string{DefaultValuesKey: "image: app", "gz.yaml": "zone: gz"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-values", Namespace: "default"},
+			Data:       map[string][]byte{DefaultValuesKey: []byte("password: secret")},
+		},
+	)
+
+	args := []struct {
+		name     string
+		selector *workloadv1beta1.ResourceKeySelector
+		defKey   string
+		want     []byte
+		wantErr  bool
+	}{
+		{
+			name:     "configmap binary data",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-chart"},
+			defKey:   DefaultChartKey,
+			want:     []byte("chart"),
+		},
+		{
+			name:     "configmap data",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-chart"},
+			defKey:   DefaultValuesKey,
+			want:     []byte("image: app"),
+		},
+		{
+			name:     "specified key",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindConfigMap, Name: "app-chart", Key: "gz.yaml"},
+			defKey:   DefaultValuesKey,
+			want:     []byte("zone: gz"),
+		},
+		{
+			name:     "secret data",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: "app-values"},
+			defKey:   DefaultValuesKey,
+			want:     []byte("password: secret"),
+		},
+		{
+			name:     "key not found",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: "app-values"},
+			defKey:   DefaultChartKey,
+			wantErr:  true,
+		},
+		{
+			name:     "object not found",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: workloadv1beta1.ResourceKindSecret, Name: "app-chart"},
+			defKey:   DefaultChartKey,
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported kind",
+			selector: &workloadv1beta1.ResourceKeySelector{Kind: "Pod", Name: "app-chart"},
+			defKey:   DefaultChartKey,
+			wantErr:  true,
+		},
+	}
+
+	for _, ut := range args {
+		t.Run(ut.name, func(t *testing.T) {
+			data, err := GetReferencedData(kubeCli, "default", ut.selector, ut.defKey)
+			if (err != nil) != ut.wantErr {
+				t.Fatalf("expect error %v, but got %v", ut.wantErr, err)
+			}
+			if !reflect.DeepEqual(data, ut.want) {
+				t.Errorf("expect %s, but got %s", ut.want, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// secret data keys
+const (
+	caCertKey   = "ca.crt"
+	caKeyKey    = "ca.key"
+	caBundleKey = "ca-bundle.crt"
+	tlsCertKey  = corev1.TLSCertKey
+	tlsKeyKey   = corev1.TLSPrivateKeyKey
+)
+
+var (
+	apiTimeout = time.Second * 10
+)
+
+// certificates is the CA and serving certificate with PEM encoded, caBundle is the current CA
+// and the previous CAs not expired, so the replicas still serving the certificate signed by the
+// previous CA are trusted until they load the new one.
+type certificates struct {
+	caCert   []byte
+	caKey    []byte
+	caBundle []byte
+	tlsCert  []byte
+	tlsKey   []byte
+}
+
+// certManager generates and rotates the webhook serving certificate, stores it in a secret,
+// writes it to the cert dir and patches the caBundle into the webhook configurations.
+type certManager struct {
+	kubeInterface kubernetes.Interface
+	opt           *Options
+	now           func() time.Time
+}
+
+func newCertManager(kubeInterface kubernetes.Interface, opt *Options) *certManager {
+	return &certManager{
+		kubeInterface: kubeInterface,
+		opt:           opt,
+		now:           time.Now,
+	}
+}
+
+// Start check certificate periodically
+func (c *certManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.opt.CertCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.ensure(); err != nil {
+				klog.Errorf("Ensure webhook certificate failed: %v", err)
+			}
+		}
+	}
+}
+
+// ensure the serving certificate is valid, written to the cert dir and trusted by the webhook configurations
+func (c *certManager) ensure() error {
+	certs, err := c.ensureSecret()
+	if err != nil {
+		return err
+	}
+	if err = c.writeCertFiles(certs); err != nil {
+		return err
+	}
+	return c.patchCABundle(certs.caBundle)
+}
+
+func (c *certManager) ensureSecret() (*certificates, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), apiTimeout)
+	defer cancel()
+
+	secrets := c.kubeInterface.CoreV1().Secrets(c.opt.ServiceNamespace)
+	secret, err := secrets.Get(ctx, c.opt.SecretName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("get secret %s/%s failed: %v", c.opt.ServiceNamespace, c.opt.SecretName, err)
+	}
+
+	var current *certificates
+	exists := err == nil
+	if exists {
+		current = c.certificatesFromSecret(secret)
+		if c.isValid(current) {
+			return current, nil
+		}
+	}
+
+	certs, err := c.generate(current)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{
+		caCertKey:   certs.caCert,
+		caKeyKey:    certs.caKey,
+		caBundleKey: certs.caBundle,
+		tlsCertKey:  certs.tlsCert,
+		tlsKeyKey:   certs.tlsKey,
+	}
+
+	if !exists {
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      c.opt.SecretName,
+				Namespace: c.opt.ServiceNamespace,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}, metav1.CreateOptions{})
+	} else {
+		secret.Data = data
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+			// other replica generated it at the same time, use that one
+			return c.loadSecret(ctx)
+		}
+		return nil, fmt.Errorf("save certificate to secret %s/%s failed: %v", c.opt.ServiceNamespace, c.opt.SecretName, err)
+	}
+	klog.Infof("Generate webhook certificate for service %s/%s successfully", c.opt.ServiceNamespace, c.opt.ServiceName)
+	return certs, nil
+}
+
+// loadSecret read the certificate saved by other replica, it must be valid
+func (c *certManager) loadSecret(ctx context.Context) (*certificates, error) {
+	secret, err := c.kubeInterface.CoreV1().Secrets(c.opt.ServiceNamespace).Get(ctx, c.opt.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get secret %s/%s saved by others failed: %v", c.opt.ServiceNamespace, c.opt.SecretName, err)
+	}
+	certs := c.certificatesFromSecret(secret)
+	if !c.isValid(certs) {
+		return nil, fmt.Errorf("secret %s/%s saved by others is invalid, retry later", c.opt.ServiceNamespace, c.opt.SecretName)
+	}
+	klog.Infof("Use webhook certificate of secret %s/%s saved by others", c.opt.ServiceNamespace, c.opt.SecretName)
+	return certs, nil
+}
+
+// certificatesFromSecret the caBundle of secrets saved before it exists is the CA
+func (c *certManager) certificatesFromSecret(secret *corev1.Secret) *certificates {
+	certs := &certificates{
+		caCert:  secret.Data[caCertKey],
+		caKey:   secret.Data[caKeyKey],
+		tlsCert: secret.Data[tlsCertKey],
+		tlsKey:  secret.Data[tlsKeyKey],
+	}
+	previous := secret.Data[caBundleKey]
+	if len(previous) == 0 {
+		previous = certs.caCert
+	}
+	certs.caBundle = c.buildCABundle(certs.caCert, previous)
+	return certs
+}
+
+// isValid the serving certificate is signed by the CA, issued for the service and not near expiry
+func (c *certManager) isValid(certs *certificates) bool {
+	if certs == nil {
+		return false
+	}
+	if _, err := parseKey(certs.caKey); err != nil {
+		return false
+	}
+	caCert, err := parseCert(certs.caCert)
+	if err != nil {
+		return false
+	}
+	tlsCert, err := parseCert(certs.tlsCert)
+	if err != nil {
+		return false
+	}
+	if _, err = parseKey(certs.tlsKey); err != nil {
+		return false
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	_, err = tlsCert.Verify(x509.VerifyOptions{
+		DNSName:     c.dnsNames()[0],
+		Roots:       pool,
+		CurrentTime: c.now().Add(c.opt.CertRotateBefore),
+	})
+	if err != nil {
+		klog.V(4).Infof("Webhook certificate need rotate: %v", err)
+		return false
+	}
+	return true
+}
+
+// generate a new serving certificate, the CA is reused if it is still valid
+func (c *certManager) generate(current *certificates) (*certificates, error) {
+	now := c.now()
+
+	var (
+		caCert *x509.Certificate
+		caKey  *rsa.PrivateKey
+		certs  = &certificates{}
+	)
+	if current != nil {
+		cert, certErr := parseCert(current.caCert)
+		key, keyErr := parseKey(current.caKey)
+		if certErr == nil && keyErr == nil && now.Add(c.opt.CertValidity).Before(cert.NotAfter) {
+			caCert, caKey = cert, key
+			certs.caCert, certs.caKey = current.caCert, current.caKey
+		}
+	}
+
+	if caCert == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("generate CA key failed: %v", err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          newSerialNumber(),
+			Subject:               pkix.Name{CommonName: c.opt.ServiceName + "-ca"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(c.opt.CertValidity * 10),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			return nil, fmt.Errorf("create CA certificate failed: %v", err)
+		}
+		caCert, err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse CA certificate failed: %v", err)
+		}
+		caKey = key
+		certs.caCert = encodeCert(der)
+		certs.caKey = encodeKey(key)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generate serving key failed: %v", err)
+	}
+	dnsNames := c.dnsNames()
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(c.opt.CertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("create serving certificate failed: %v", err)
+	}
+	certs.tlsCert = encodeCert(der)
+	certs.tlsKey = encodeKey(key)
+
+	var previous []byte
+	if current != nil {
+		previous = current.caBundle
+	}
+	certs.caBundle = c.buildCABundle(certs.caCert, previous)
+	return certs, nil
+}
+
+// buildCABundle returns caCert followed by the certificates of previous which are not expired and
+// not the same as caCert
+func (c *certManager) buildCABundle(caCert, previous []byte) []byte {
+	bundle := append([]byte{}, caCert...)
+	current, _ := pem.Decode(caCert)
+	now := c.now()
+	for rest := previous; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if current != nil && bytes.Equal(block.Bytes, current.Bytes) {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || now.After(cert.NotAfter) {
+			continue
+		}
+		bundle = append(bundle, encodeCert(block.Bytes)...)
+	}
+	return bundle
+}
+
+func (c *certManager) dnsNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", c.opt.ServiceName, c.opt.ServiceNamespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", c.opt.ServiceName, c.opt.ServiceNamespace),
+		fmt.Sprintf("%s.%s", c.opt.ServiceName, c.opt.ServiceNamespace),
+		c.opt.ServiceName,
+	}
+}
+
+// writeCertFiles write the serving certificate to cert dir, the webhook server watches and reloads it
+func (c *certManager) writeCertFiles(certs *certificates) error {
+	if err := os.MkdirAll(c.opt.CertDir, 0755); err != nil {
+		return fmt.Errorf("create cert dir %s failed: %v", c.opt.CertDir, err)
+	}
+	files := map[string][]byte{
+		tlsCertKey: certs.tlsCert,
+		tlsKeyKey:  certs.tlsKey,
+	}
+	for name, data := range files {
+		path := filepath.Join(c.opt.CertDir, name)
+		if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("write %s failed: %v", path, err)
+		}
+		klog.V(4).Infof("Write webhook certificate file %s successfully", path)
+	}
+	return nil
+}
+
+// patchCABundle set caBundle to all webhooks of the mutating and validating webhook configuration
+func (c *certManager) patchCABundle(caBundle []byte) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), apiTimeout)
+	defer cancel()
+
+	var errs []string
+	if name := c.opt.MutatingWebhookConfigurationName; name != "" {
+		cli := c.kubeInterface.AdmissionregistrationV1().MutatingWebhookConfigurations()
+		mwc, err := cli.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("get MutatingWebhookConfiguration %s failed: %v", name, err))
+		} else {
+			changed := false
+			for i := range mwc.Webhooks {
+				if !bytes.Equal(mwc.Webhooks[i].ClientConfig.CABundle, caBundle) {
+					mwc.Webhooks[i].ClientConfig.CABundle = caBundle
+					changed = true
+				}
+			}
+			if changed {
+				if _, err = cli.Update(ctx, mwc, metav1.UpdateOptions{}); err != nil {
+					errs = append(errs, fmt.Sprintf("update MutatingWebhookConfiguration %s caBundle failed: %v", name, err))
+				} else {
+					klog.Infof("Update MutatingWebhookConfiguration %s caBundle successfully", name)
+				}
+			}
+		}
+	}
+
+	if name := c.opt.ValidatingWebhookConfigurationName; name != "" {
+		cli := c.kubeInterface.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+		vwc, err := cli.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("get ValidatingWebhookConfiguration %s failed: %v", name, err))
+		} else {
+			changed := false
+			for i := range vwc.Webhooks {
+				if !bytes.Equal(vwc.Webhooks[i].ClientConfig.CABundle, caBundle) {
+					vwc.Webhooks[i].ClientConfig.CABundle = caBundle
+					changed = true
+				}
+			}
+			if changed {
+				if _, err = cli.Update(ctx, vwc, metav1.UpdateOptions{}); err != nil {
+					errs = append(errs, fmt.Sprintf("update ValidatingWebhookConfiguration %s caBundle failed: %v", name, err))
+				} else {
+					klog.Infof("Update ValidatingWebhookConfiguration %s caBundle successfully", name)
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("patch caBundle failed: %v", errs)
+	}
+	return nil
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func parseCert(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("certificate is not PEM encoded")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parseKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
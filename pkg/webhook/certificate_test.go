@@ -0,0 +1,215 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestCertManager(t *testing.T) *certManager {
+	opt := DefaultOptions()
+	opt.CertDir = t.TempDir()
+
+	kube := fake.NewSimpleClientset(
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: opt.MutatingWebhookConfigurationName},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{
+				{Name: "mappset.workload.dmall.com"},
+				{Name: "madvdeployment.workload.dmall.com"},
+			},
+		},
+		&admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: opt.ValidatingWebhookConfigurationName},
+			Webhooks: []admissionregistrationv1.ValidatingWebhook{
+				{Name: "vappset.workload.dmall.com"},
+				{Name: "vadvdeployment.workload.dmall.com"},
+			},
+		},
+	)
+	return newCertManager(kube, opt)
+}
+
+func TestCertManagerEnsure(t *testing.T) {
+	c := newTestCertManager(t)
+	if err := c.ensure(); err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	secret, err := c.kubeInterface.CoreV1().Secrets(c.opt.ServiceNamespace).Get(context.TODO(), c.opt.SecretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret failed: %v", err)
+	}
+	certs := &certificates{
+		caCert:  secret.Data[caCertKey],
+		caKey:   secret.Data[caKeyKey],
+		tlsCert: secret.Data[tlsCertKey],
+		tlsKey:  secret.Data[tlsKeyKey],
+	}
+	if !c.isValid(certs) {
+		t.Error("generated certificate is invalid")
+	}
+
+	for name, data := range map[string][]byte{tlsCertKey: certs.tlsCert, tlsKeyKey: certs.tlsKey} {
+		got, err := ioutil.ReadFile(filepath.Join(c.opt.CertDir, name))
+		if err != nil {
+			t.Errorf("read %s failed: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s is not the same as secret", name)
+		}
+	}
+
+	mwc, err := c.kubeInterface.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), c.opt.MutatingWebhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get MutatingWebhookConfiguration failed: %v", err)
+	}
+	for _, wh := range mwc.Webhooks {
+		if !bytes.Equal(wh.ClientConfig.CABundle, certs.caCert) {
+			t.Errorf("webhook %s caBundle is not patched", wh.Name)
+		}
+	}
+	vwc, err := c.kubeInterface.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), c.opt.ValidatingWebhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get ValidatingWebhookConfiguration failed: %v", err)
+	}
+	for _, wh := range vwc.Webhooks {
+		if !bytes.Equal(wh.ClientConfig.CABundle, certs.caCert) {
+			t.Errorf("webhook %s caBundle is not patched", wh.Name)
+		}
+	}
+
+	// ensure again, the certificate should not be regenerated
+	if err = c.ensure(); err != nil {
+		t.Fatalf("ensure again failed: %v", err)
+	}
+	again, err := c.ensureSecret()
+	if err != nil {
+		t.Fatalf("ensure secret failed: %v", err)
+	}
+	if !bytes.Equal(again.tlsCert, certs.tlsCert) {
+		t.Error("valid certificate should not be regenerated")
+	}
+}
+
+func TestCertManagerRotate(t *testing.T) {
+	c := newTestCertManager(t)
+	current, err := c.ensureSecret()
+	if err != nil {
+		t.Fatalf("ensure secret failed: %v", err)
+	}
+
+	args := []struct {
+		name    string
+		after   time.Duration
+		rotate  bool
+		reuseCA bool
+	}{
+		{
+			name:    "not near expiry",
+			after:   c.opt.CertValidity - c.opt.CertRotateBefore*2,
+			rotate:  false,
+			reuseCA: true,
+		},
+		{
+			name:    "near expiry rotate serving certificate and reuse CA",
+			after:   c.opt.CertValidity - c.opt.CertRotateBefore/2,
+			rotate:  true,
+			reuseCA: true,
+		},
+		{
+			name:    "CA near expiry rotate CA",
+			after:   c.opt.CertValidity*10 - c.opt.CertRotateBefore/2,
+			rotate:  true,
+			reuseCA: false,
+		},
+	}
+	for _, arg := range args {
+		t.Run(arg.name, func(t *testing.T) {
+			now := time.Now().Add(arg.after)
+			c.now = func() time.Time { return now }
+
+			if c.isValid(current) == arg.rotate {
+				t.Errorf("expect rotate %v", arg.rotate)
+			}
+			if !arg.rotate {
+				return
+			}
+
+			certs, err := c.generate(current)
+			if err != nil {
+				t.Fatalf("generate failed: %v", err)
+			}
+			if bytes.Equal(certs.caCert, current.caCert) != arg.reuseCA {
+				t.Errorf("expect reuse CA %v", arg.reuseCA)
+			}
+			if !c.isValid(certs) {
+				t.Error("rotated certificate is invalid")
+			}
+			if !bytes.HasPrefix(certs.caBundle, certs.caCert) {
+				t.Error("caBundle should start with the current CA")
+			}
+			if !arg.reuseCA && !bytes.Contains(certs.caBundle, current.caCert) {
+				t.Error("caBundle should keep the previous CA not expired")
+			}
+			if arg.reuseCA && !bytes.Equal(certs.caBundle, certs.caCert) {
+				t.Error("caBundle should be the CA if CA is not rotated")
+			}
+		})
+	}
+}
+
+func TestBuildCABundleDropExpired(t *testing.T) {
+	c := newTestCertManager(t)
+	old, err := c.generate(nil)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	now := time.Now().Add(c.opt.CertValidity*10 + time.Hour)
+	c.now = func() time.Time { return now }
+	certs, err := c.generate(old)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if !bytes.Equal(certs.caBundle, certs.caCert) {
+		t.Error("expired CA should be dropped from caBundle")
+	}
+}
+
+func TestCertManagerEnsureSecretConflict(t *testing.T) {
+	other := newTestCertManager(t)
+	saved, err := other.ensureSecret()
+	if err != nil {
+		t.Fatalf("ensure secret failed: %v", err)
+	}
+
+	// the secret was not created when this replica read it
+	kube := other.kubeInterface.(*fake.Clientset)
+	notFound := true
+	kube.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if notFound {
+			notFound = false
+			return true, nil, apierrors.NewNotFound(corev1.Resource("secrets"), other.opt.SecretName)
+		}
+		return false, nil, nil
+	})
+	c := newCertManager(kube, other.opt)
+	certs, err := c.ensureSecret()
+	if err != nil {
+		t.Fatalf("expect the secret saved by others, but got %v", err)
+	}
+	if !bytes.Equal(certs.tlsCert, saved.tlsCert) || !bytes.Equal(certs.caBundle, saved.caBundle) {
+		t.Error("expect the certificate saved by others")
+	}
+}
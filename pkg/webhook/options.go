@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/symcn/api"
+	"github.com/symcn/pkg/clustermanager/client"
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+func init() {
+	clientgoscheme.AddToScheme(types.Scheme)
+	workloadv1beta1.AddToScheme(types.Scheme)
+}
+
+// Options webhook server options
+type Options struct {
+	ClusterManagerOptions *client.Options
+
+	Port    int
+	CertDir string
+
+	// ServiceName and ServiceNamespace is the service in front of the webhook server,
+	// the serving certificate is issued for it.
+	ServiceName      string
+	ServiceNamespace string
+	// SecretName is the secret which stores the CA and serving certificate, all
+	// webhook replicas share it.
+	SecretName string
+
+	MutatingWebhookConfigurationName   string
+	ValidatingWebhookConfigurationName string
+
+	// CertValidity is the validity of the serving certificate, CA is valid for ten times of it.
+	CertValidity time.Duration
+	// CertRotateBefore rotate certificate when the remaining validity is less than it.
+	CertRotateBefore time.Duration
+	// CertCheckInterval is the interval of checking certificate and caBundle.
+	CertCheckInterval time.Duration
+}
+
+// DefaultOptions default webhook options
+func DefaultOptions() *Options {
+	opt := client.DefaultOptionsWithScheme(types.Scheme)
+	opt.SetKubeRestConfigFnList = []api.SetKubeRestConfig{
+		func(cfg *rest.Config) {
+			cfg.UserAgent = "sym-ops-webhook"
+		},
+	}
+
+	return &Options{
+		ClusterManagerOptions:              opt,
+		Port:                               9443,
+		CertDir:                            "/tmp/k8s-webhook-server/serving-certs",
+		ServiceName:                        "sym-ops-webhook",
+		ServiceNamespace:                   types.MultiClusterCfgConfigmapNamespace,
+		SecretName:                         "sym-ops-webhook-certs",
+		MutatingWebhookConfigurationName:   "mutating-webhook-configuration",
+		ValidatingWebhookConfigurationName: "validating-webhook-configuration",
+		CertValidity:                       time.Hour * 24 * 365,
+		CertRotateBefore:                   time.Hour * 24 * 30,
+		CertCheckInterval:                  time.Hour,
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"testing"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+// webhookConfiguration is the part of Mutating and Validating WebhookConfiguration checked
+type webhookConfiguration struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Webhooks []struct {
+		Name         string `json:"name"`
+		ClientConfig struct {
+			Service struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"service"`
+		} `json:"clientConfig"`
+	} `json:"webhooks"`
+}
+
+func TestDefaultOptionsMatchManifests(t *testing.T) {
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), "../../config/default")
+	if err != nil {
+		t.Fatalf("build config/default failed: %v", err)
+	}
+
+	opt := DefaultOptions()
+	expectNames := map[string]string{
+		"MutatingWebhookConfiguration":   opt.MutatingWebhookConfigurationName,
+		"ValidatingWebhookConfiguration": opt.ValidatingWebhookConfigurationName,
+	}
+	found := 0
+	for _, res := range resMap.Resources() {
+		expectName, ok := expectNames[res.GetKind()]
+		if !ok {
+			continue
+		}
+		found++
+		data, err := res.AsYAML()
+		if err != nil {
+			t.Fatalf("%s to yaml failed: %v", res.GetKind(), err)
+		}
+		config := &webhookConfiguration{}
+		if err = yaml.Unmarshal(data, config); err != nil {
+			t.Fatalf("parse %s failed: %v", res.GetKind(), err)
+		}
+		if config.Metadata.Name != expectName {
+			t.Errorf("expect %s named %s to patch caBundle, but got %s", config.Kind, expectName, config.Metadata.Name)
+		}
+		for _, webhook := range config.Webhooks {
+			svc := webhook.ClientConfig.Service
+			if svc.Name != opt.ServiceName || svc.Namespace != opt.ServiceNamespace {
+				t.Errorf("expect webhook %s service %s/%s the certificate is issued for, but got %s/%s", webhook.Name, opt.ServiceNamespace, opt.ServiceName, svc.Namespace, svc.Name)
+			}
+		}
+	}
+	if found != len(expectNames) {
+		t.Errorf("expect %d webhook configurations, but got %d", len(expectNames), found)
+	}
+}
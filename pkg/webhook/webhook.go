@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/symcn/api"
+	"github.com/symcn/pkg/clustermanager/client"
+	"github.com/symcn/pkg/clustermanager/configuration"
+	workloadv1beta1 "github.com/symcn/sym-ops/api/v1beta1"
+	"github.com/symcn/sym-ops/pkg/types"
+	"github.com/symcn/sym-ops/pkg/utils"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	rtwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// admission endpoints, must be the same as the kubebuilder:webhook markers in api/v1beta1
+const (
+	mutateAppSetPath          = "/mutate-workload-dmall-com-v1beta1-appset"
+	validateAppSetPath        = "/validate-workload-dmall-com-v1beta1-appset"
+	mutateAdvDeploymentPath   = "/mutate-workload-dmall-com-v1beta1-advdeployment"
+	validateAdvDeploymentPath = "/validate-workload-dmall-com-v1beta1-advdeployment"
+)
+
+// Server admission webhook server for AppSet and AdvDeployment
+type Server struct {
+	*Options
+
+	currentCli  api.MingleClient
+	certManager *certManager
+	server      *utils.Server
+}
+
+// NewServer build webhook Server
+func NewServer(opt *Options) (*Server, error) {
+	currentCli, err := client.NewMingleClient(client.DefaultClusterCfgInfo(types.CurrentClusterName), opt.ClusterManagerOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Options:     opt,
+		currentCli:  currentCli,
+		certManager: newCertManager(currentCli.GetKubeInterface(), opt),
+		server:      &utils.Server{},
+	}
+
+	// AppSet check target clusters with multi cluster configuration
+	clusters := &clusterLister{
+		clusterCfgManager: configuration.NewClusterCfgManagerWithCM(
+			currentCli.GetKubeInterface(),
+			types.MultiClusterCfgConfigmapNamespace,
+			types.MultiClusterCfgConfigmapLabels,
+			types.MultiClusterCfgConfigmapDataKey,
+			types.MultiClusterCfgConfigmapStatusKey,
+		),
+	}
+
+	s.server.Add(s.certManager)
+	s.server.Add(&admissionServer{opt: opt, clusters: clusters})
+	return s, nil
+}
+
+// Start start webhook server
+func (s *Server) Start() error {
+	// the serving certificate must exist before the https server start
+	if err := s.certManager.ensure(); err != nil {
+		return fmt.Errorf("prepare webhook certificate failed: %v", err)
+	}
+
+	ctx := signals.SetupSignalHandler()
+	if err := s.server.Start(ctx); err != nil {
+		klog.Error(err)
+		return err
+	}
+	return nil
+}
+
+type admissionServer struct {
+	opt      *Options
+	clusters workloadv1beta1.ClusterLister
+}
+
+func (a *admissionServer) Start(ctx context.Context) error {
+	srv := &rtwebhook.Server{
+		Port:    a.opt.Port,
+		CertDir: a.opt.CertDir,
+	}
+	srv.Register(mutateAppSetPath, admission.DefaultingWebhookFor(&workloadv1beta1.AppSet{}))
+	srv.Register(validateAppSetPath, admission.WithCustomValidator(&workloadv1beta1.AppSet{}, &workloadv1beta1.AppSetValidator{Clusters: a.clusters}))
+	srv.Register(mutateAdvDeploymentPath, admission.DefaultingWebhookFor(&workloadv1beta1.AdvDeployment{}))
+	srv.Register(validateAdvDeploymentPath, admission.ValidatingWebhookFor(&workloadv1beta1.AdvDeployment{}))
+
+	klog.Infof("Start webhook server on port %d", a.opt.Port)
+	return srv.StartStandalone(ctx, types.Scheme)
+}
+
+// clusterLister lists the clusters in the multi cluster configuration configmap
+type clusterLister struct {
+	clusterCfgManager api.ClusterConfigurationManager
+}
+
+func (l *clusterLister) ListClusterNames() ([]string, error) {
+	list, err := l.clusterCfgManager.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list))
+	for _, cfg := range list {
+		names = append(names, cfg.GetName())
+	}
+	return names, nil
+}